@@ -0,0 +1,173 @@
+package indigo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Action is the interface that wraps the Execute method.
+// Execute performs a side effect of a rule's evaluation, such as sending a
+// notification or updating a record. It is called after the rule tree has
+// been evaluated, with the result of the rule the action is attached to and
+// the input data, including the values of the data elements resolved by a
+// DataProvider (see Provider). Execute must not modify the result or the
+// data.
+//
+// Actions are attached to rules by name (see Rule.OnPass and Rule.OnFail),
+// and looked up in an ActionRegistry provided with the RunActions option.
+type Action interface {
+	Execute(ctx context.Context, u *Result, d map[string]interface{}) error
+}
+
+// ActionFunc is an adapter to allow the use of an ordinary function as an Action.
+type ActionFunc func(ctx context.Context, u *Result, d map[string]interface{}) error
+
+// Execute calls f(ctx, u, d).
+func (f ActionFunc) Execute(ctx context.Context, u *Result, d map[string]interface{}) error {
+	return f(ctx, u, d)
+}
+
+// ActionRegistry holds actions by name. Rules refer to actions by name, so
+// that rules can be serialized and stored separately from the code that
+// implements the actions. An ActionRegistry is safe for concurrent use.
+type ActionRegistry struct {
+	mu      sync.RWMutex
+	actions map[string]Action
+}
+
+// NewActionRegistry returns an empty registry.
+func NewActionRegistry() *ActionRegistry {
+	return &ActionRegistry{
+		actions: map[string]Action{},
+	}
+}
+
+// Register adds the action to the registry under the name. It returns an
+// error if the name is blank, the action is nil, or another action is
+// already registered with the name.
+func (a *ActionRegistry) Register(name string, x Action) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("action name is required")
+	}
+	if x == nil {
+		return fmt.Errorf("action %s: action is nil", name)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.actions[name]; ok {
+		return fmt.Errorf("action %s: already registered", name)
+	}
+	a.actions[name] = x
+	return nil
+}
+
+// Lookup returns the action registered under the name.
+func (a *ActionRegistry) Lookup(name string) (Action, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	x, ok := a.actions[name]
+	return x, ok
+}
+
+// ActionRun records an action that fired after an evaluation.
+type ActionRun struct {
+	// The name of the action
+	Action string
+
+	// The ID of the rule the action is attached to
+	RuleID string
+
+	// Whether the action fired because the rule passed (OnPass) or failed (OnFail)
+	Pass bool
+
+	// Whether the action was executed. False if the DryRunActions option was set.
+	Executed bool
+
+	// The error returned by the action, or the reason it could not be executed
+	Err error
+
+	// the result of the rule, passed to the action
+	result *Result
+}
+
+// ActionError is returned by Eval when one or more actions returned an
+// error. The other actions are executed regardless, and the Result of the
+// evaluation is returned along with the error.
+type ActionError struct {
+	// The actions that failed, in the order they were executed
+	Failed []ActionRun
+}
+
+// Error lists the actions that failed.
+func (e *ActionError) Error() string {
+	l := make([]string, 0, len(e.Failed))
+	for _, a := range e.Failed {
+		l = append(l, fmt.Sprintf("rule %s: action %s: %v", a.RuleID, a.Action, a.Err))
+	}
+	return strings.Join(l, "; ")
+}
+
+// Unwrap returns the error of the first action that failed.
+func (e *ActionError) Unwrap() error {
+	if len(e.Failed) == 0 {
+		return nil
+	}
+	return e.Failed[0].Err
+}
+
+// firedActions returns the actions of the rule that fire given its result.
+// Skipped rules do not fire actions.
+func firedActions(u *Result) []ActionRun {
+	if u.Skipped {
+		return nil
+	}
+
+	names := u.Rule.OnFail
+	if u.Pass {
+		names = u.Rule.OnPass
+	}
+
+	l := make([]ActionRun, 0, len(names))
+	for _, n := range names {
+		l = append(l, ActionRun{
+			Action: n,
+			RuleID: u.Rule.ID,
+			Pass:   u.Pass,
+			result: u,
+		})
+	}
+	return l
+}
+
+// runActions executes the actions in order, recording the outcome of each.
+// If dryRun is set, the actions are only looked up, not executed.
+// Returns an ActionError if any action failed.
+func runActions(ctx context.Context, reg *ActionRegistry, runs []ActionRun, d map[string]interface{}, dryRun bool) error {
+	failed := []ActionRun{}
+	for i := range runs {
+		a := &runs[i]
+		x, ok := reg.Lookup(a.Action)
+		switch {
+		case !ok:
+			a.Err = fmt.Errorf("unknown action")
+		case dryRun:
+		case ctx.Err() != nil:
+			a.Err = ctx.Err()
+		default:
+			a.Executed = true
+			a.Err = x.Execute(ctx, a.result, d)
+		}
+
+		if a.Err != nil {
+			failed = append(failed, *a)
+		}
+	}
+
+	if len(failed) > 0 {
+		return &ActionError{Failed: failed}
+	}
+	return nil
+}
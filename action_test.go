@@ -0,0 +1,118 @@
+package indigo_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/matryer/is"
+)
+
+// makeActionRule attaches actions to rules in the rule tree made by makeRule
+func makeActionRule() *indigo.Rule {
+	r := makeRule()
+	r.OnFail = []string{"log"}
+	r.Rules["D"].OnFail = []string{"log"}
+	r.Rules["D"].Rules["d1"].OnPass = []string{"log"}
+	r.Rules["D"].Rules["d1"].OnFail = []string{"broken"}
+	r.Rules["D"].Rules["d2"].OnFail = []string{"log", "broken"}
+	r.Rules["E"].Rules["e2"].OnFail = []string{"missing"}
+	return r
+}
+
+func TestActions(t *testing.T) {
+	is := is.New(t)
+
+	fired := []string{}
+	reg := indigo.NewActionRegistry()
+	is.NoErr(reg.Register("log", indigo.ActionFunc(func(ctx context.Context, u *indigo.Result, d map[string]interface{}) error {
+		fired = append(fired, fmt.Sprintf("%s:%t", u.Rule.ID, u.Pass))
+		return nil
+	})))
+	is.NoErr(reg.Register("broken", indigo.ActionFunc(func(ctx context.Context, u *indigo.Result, d map[string]interface{}) error {
+		return fmt.Errorf("out of order")
+	})))
+
+	e := indigo.NewEngine(newMockEvaluator())
+	r := makeActionRule()
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{}, indigo.RunActions(reg))
+	is.True(u != nil)
+
+	// the failing actions did not stop the others from running
+	var ae *indigo.ActionError
+	is.True(errors.As(err, &ae))
+	is.Equal(len(ae.Failed), 2)
+	is.Equal(ae.Failed[0].Action, "broken")
+	is.Equal(ae.Failed[1].Action, "missing")
+	is.Equal(err.Error(), "rule d2: action broken: out of order; rule e2: action missing: unknown action")
+
+	// child rules fire before their parents
+	is.Equal(fired, []string{"d1:true", "d2:false", "D:false", "rule1:false"})
+
+	got := []string{}
+	for _, a := range u.Actions {
+		got = append(got, fmt.Sprintf("%s/%s/%t", a.RuleID, a.Action, a.Executed))
+	}
+	is.Equal(got, []string{"d1/log/true", "d2/log/true", "d2/broken/true", "D/log/true", "e2/missing/false", "rule1/log/true"})
+
+	// the outcome of the actions is included in the JSON representation
+	b, err := json.Marshal(u)
+	is.NoErr(err)
+	u2 := &indigo.Result{}
+	is.NoErr(json.Unmarshal(b, u2))
+	is.Equal(len(u2.Actions), 6)
+	is.Equal(u2.Actions[2].Err.Error(), "out of order")
+
+	// without the option, no actions are executed
+	fired = fired[:0]
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	is.Equal(len(u.Actions), 0)
+	is.Equal(len(fired), 0)
+}
+
+func TestDryRunActions(t *testing.T) {
+	is := is.New(t)
+
+	n := 0
+	reg := indigo.NewActionRegistry()
+	for _, name := range []string{"log", "broken", "missing"} {
+		is.NoErr(reg.Register(name, indigo.ActionFunc(func(ctx context.Context, u *indigo.Result, d map[string]interface{}) error {
+			n++
+			return nil
+		})))
+	}
+
+	e := indigo.NewEngine(newMockEvaluator())
+	r := makeActionRule()
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{}, indigo.RunActions(reg), indigo.DryRunActions(true))
+	is.NoErr(err)
+	is.Equal(n, 0)
+	is.Equal(len(u.Actions), 6)
+	for _, a := range u.Actions {
+		is.True(!a.Executed)
+	}
+}
+
+func TestActionRegistry(t *testing.T) {
+	is := is.New(t)
+
+	noop := indigo.ActionFunc(func(ctx context.Context, u *indigo.Result, d map[string]interface{}) error { return nil })
+	reg := indigo.NewActionRegistry()
+	is.NoErr(reg.Register("a", noop))
+	is.True(reg.Register("a", noop) != nil)
+	is.True(reg.Register(" ", noop) != nil)
+	is.True(reg.Register("b", nil) != nil)
+
+	_, ok := reg.Lookup("a")
+	is.True(ok)
+	_, ok = reg.Lookup("b")
+	is.True(!ok)
+}
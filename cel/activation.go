@@ -0,0 +1,39 @@
+package cel
+
+import (
+	"github.com/ezachrisen/indigo"
+
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/interpreter"
+)
+
+// activation provides the input data to a CEL program. Data elements
+// resolved by an indigo.DataProvider are passed as *indigo.LazyValue, and
+// only resolved when the program uses them.
+type activation struct {
+	data map[string]interface{}
+}
+
+// ResolveName returns the value of the data element with the name.
+func (a *activation) ResolveName(name string) (interface{}, bool) {
+	v, ok := a.data[name]
+	if !ok {
+		return nil, false
+	}
+
+	lv, ok := v.(*indigo.LazyValue)
+	if !ok {
+		return v, true
+	}
+
+	v, ok, err := lv.Value()
+	if err != nil {
+		return types.NewErr("%v", err), true
+	}
+	return v, ok
+}
+
+// Parent returns nil; the activation has no parent.
+func (a *activation) Parent() interpreter.Activation {
+	return nil
+}
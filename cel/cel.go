@@ -23,9 +23,11 @@ type Evaluator struct {
 // celProgram holds a compiled CEL Program and
 // optionally an AST. The AST is used if we're collecting diagnostics
 // for the engine. Indigo will attach celProgram to the rule during compilation.
+// The checked AST is used to find the data the rule refers to (see References).
 type celProgram struct {
 	program celgo.Program
 	ast     *celgo.Ast
+	checked *celgo.Ast
 }
 
 // NewEvaluator creates a new CEL Evaluator.
@@ -118,6 +120,7 @@ func (e *Evaluator) Compile(expr string, s indigo.Schema, resultType indigo.Type
 	if collectDiagnostics {
 		prog.ast = ast
 	}
+	prog.checked = c
 
 	options := celgo.EvalOptions()
 	if collectDiagnostics {
@@ -164,7 +167,7 @@ func (*Evaluator) Evaluate(data map[string]interface{}, expr string, _ indigo.Sc
 		return nil, nil, fmt.Errorf("missing program")
 	}
 
-	rawValue, details, err := program.program.Eval(data)
+	rawValue, details, err := program.program.Eval(&activation{data: data})
 
 	// Do not check the error yet. Grab the diagnostics first
 	var diagnostics *indigo.Diagnostics
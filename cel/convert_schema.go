@@ -9,11 +9,15 @@ package cel
 
 import (
 	"fmt"
+	"reflect"
+	"time"
 
 	"github.com/ezachrisen/indigo"
 	celgo "github.com/google/cel-go/cel"
 	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/ext"
 	gexpr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"google.golang.org/protobuf/proto"
 )
 
 // convertIndigoSchemaToDeclarations converts an Indigo Schema to a list of CEL "EnvOption".
@@ -27,6 +31,11 @@ func convertIndigoSchemaToDeclarations(s indigo.Schema) ([]celgo.EnvOption, erro
 	// we'll collect them in types
 	types := []interface{}{}
 
+	// Go struct types, including the structs used in their fields, are
+	// registered as native types
+	structs := []interface{}{}
+	seen := map[reflect.Type]bool{}
+
 	for _, d := range s.Elements {
 		typ, err := convertIndigoToExprType(d.Type)
 
@@ -38,11 +47,16 @@ func convertIndigoSchemaToDeclarations(s indigo.Schema) ([]celgo.EnvOption, erro
 		if v, ok := d.Type.(indigo.Proto); ok {
 			types = append(types, v.Message)
 		}
+		structs = collectStructTypes(d.Type, seen, structs)
 	}
 
 	opts := []celgo.EnvOption{}
 	opts = append(opts, celgo.Declarations(declarations...))
 	opts = append(opts, celgo.Types(types...))
+	// native types must be registered after protocol buffer types
+	if len(structs) > 0 {
+		opts = append(opts, ext.NativeTypes(structs...))
+	}
 	if len(opts) == 0 {
 		return nil, fmt.Errorf("no valid schema")
 	}
@@ -67,6 +81,8 @@ func convertIndigoToExprType(t indigo.Type) (*gexpr.Type, error) {
 		return decls.Duration, nil
 	case indigo.Timestamp:
 		return decls.Timestamp, nil
+	case indigo.Any:
+		return decls.Dyn, nil
 	case indigo.Map:
 		key, err := convertIndigoToExprType(v.KeyType)
 		if err != nil {
@@ -89,7 +105,58 @@ func convertIndigoToExprType(t indigo.Type) (*gexpr.Type, error) {
 			return nil, err
 		}
 		return decls.NewObjectType(n), nil
+	case indigo.Struct:
+		n, err := v.StructName()
+		if err != nil {
+			return nil, err
+		}
+		return decls.NewObjectType(n), nil
 	default:
 		return nil, fmt.Errorf("unknown indigo type %s", t)
 	}
 }
+
+// collectStructTypes adds the Go struct types used by the Indigo type to l:
+// the types of Structs, including those in Lists and Maps, and the struct
+// types of their fields.
+func collectStructTypes(t indigo.Type, seen map[reflect.Type]bool, l []interface{}) []interface{} {
+	switch v := t.(type) {
+	case indigo.List:
+		return collectStructTypes(v.ValueType, seen, l)
+	case indigo.Map:
+		return collectStructTypes(v.ValueType, seen, collectStructTypes(v.KeyType, seen, l))
+	case indigo.Struct:
+		if st, err := v.StructType(); err == nil {
+			return collectGoStructTypes(st, seen, l)
+		}
+	}
+	return l
+}
+
+// collectGoStructTypes adds the struct type, and the struct types of its
+// fields, to l.
+func collectGoStructTypes(t reflect.Type, seen map[reflect.Type]bool, l []interface{}) []interface{} {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		if t.Kind() == reflect.Map {
+			l = collectGoStructTypes(t.Key(), seen, l)
+		}
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || seen[t] || t == reflect.TypeOf(time.Time{}) {
+		return l
+	}
+	// proto messages are registered as protocol buffer types
+	if reflect.PointerTo(t).Implements(reflect.TypeOf((*proto.Message)(nil)).Elem()) {
+		return l
+	}
+
+	seen[t] = true
+	l = append(l, t)
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.IsExported() {
+			l = collectGoStructTypes(f.Type, seen, l)
+		}
+	}
+	return l
+}
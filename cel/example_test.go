@@ -913,7 +913,8 @@ func Example_alarms() {
 }
 
 // Example_alarms illustrates using the FailAction option to only return
-// true rules from evaluation with a multi-level hierarchy
+// true rules from evaluation with a multi-level hierarchy, where the child
+// rules inherit the schema of their parents
 func Example_alarmsTwoLevel() {
 
 	sysmetrics := indigo.Schema{
@@ -921,13 +922,14 @@ func Example_alarmsTwoLevel() {
 			{Name: "cpu_utilization", Type: indigo.Int{}},
 			{Name: "disk_free_space", Type: indigo.Int{}},
 			{Name: "memory_utilization", Type: indigo.Int{}},
-			{Name: "memory_mb_remaining", Type: indigo.Int{}},
 		},
 	}
 
+	// The child rules inherit the schema of the root rule
 	rule := indigo.Rule{
-		ID:    "alarm_check",
-		Rules: map[string]*indigo.Rule{},
+		ID:     "alarm_check",
+		Schema: sysmetrics,
+		Rules:  map[string]*indigo.Rule{},
 	}
 
 	// Setting this option so we only get back
@@ -935,20 +937,20 @@ func Example_alarmsTwoLevel() {
 	rule.EvalOptions.DiscardFail = indigo.Discard
 
 	rule.Rules["cpu_alarm"] = &indigo.Rule{
-		ID:     "cpu_alarm",
-		Schema: sysmetrics,
-		Expr:   "cpu_utilization > 90",
+		ID:   "cpu_alarm",
+		Expr: "cpu_utilization > 90",
 	}
 
 	rule.Rules["disk_alarm"] = &indigo.Rule{
-		ID:     "disk_alarm",
-		Schema: sysmetrics,
-		Expr:   "disk_free_space < 70",
+		ID:   "disk_alarm",
+		Expr: "disk_free_space < 70",
 	}
 
+	// The memory alarms use an additional data element
 	memory_alarm := &indigo.Rule{
-		ID:    "memory_alarm",
-		Rules: map[string]*indigo.Rule{},
+		ID:            "memory_alarm",
+		ExtraElements: []indigo.DataElement{{Name: "memory_mb_remaining", Type: indigo.Int{}}},
+		Rules:         map[string]*indigo.Rule{},
 		EvalOptions: indigo.EvalOptions{
 			DiscardFail: indigo.KeepAll,
 			TrueIfAny:   true,
@@ -956,15 +958,13 @@ func Example_alarmsTwoLevel() {
 	}
 
 	memory_alarm.Rules["memory_utilization_alarm"] = &indigo.Rule{
-		ID:     "memory_utilization_alarm",
-		Schema: sysmetrics,
-		Expr:   "memory_utilization > 90",
+		ID:   "memory_utilization_alarm",
+		Expr: "memory_utilization > 90",
 	}
 
 	memory_alarm.Rules["memory_remaining_alarm"] = &indigo.Rule{
-		ID:     "memory_remaining_alarm",
-		Schema: sysmetrics,
-		Expr:   "memory_mb_remaining < 16",
+		ID:   "memory_remaining_alarm",
+		Expr: "memory_mb_remaining < 16",
 	}
 
 	rule.Rules["memory_alarm"] = memory_alarm
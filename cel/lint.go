@@ -0,0 +1,616 @@
+package cel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ezachrisen/indigo"
+
+	celgo "github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/parser"
+	gexpr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// FindingKind identifies the type of problem reported by Lint.
+type FindingKind int
+
+const (
+	// ConstantComparison means that a comparison is always true or always
+	// false, because it compares constants or an expression with itself.
+	ConstantComparison FindingKind = iota
+
+	// UnusedElement means that a data element in a schema is not used by any
+	// of the rules using the schema.
+	UnusedElement
+
+	// UnreachableRule means that a rule is never evaluated, because of the
+	// evaluation options and the rules evaluated before it.
+	UnreachableRule
+
+	// DuplicateExpression means that a rule has the same expression as one
+	// of its siblings.
+	DuplicateExpression
+
+	// UndeclaredField means that an expression selects a field of a map or
+	// dynamically typed value, which is not declared in the schema and fails
+	// evaluation if it is missing from the data.
+	UndeclaredField
+)
+
+// String returns a human-readable name of the finding kind.
+func (k FindingKind) String() string {
+	switch k {
+	case ConstantComparison:
+		return "constant comparison"
+	case UnusedElement:
+		return "unused element"
+	case UnreachableRule:
+		return "unreachable rule"
+	case DuplicateExpression:
+		return "duplicate expression"
+	case UndeclaredField:
+		return "undeclared field"
+	default:
+		return fmt.Sprintf("FindingKind(%d)", int(k))
+	}
+}
+
+// Finding is a problem in a rule reported by Lint.
+type Finding struct {
+	Kind FindingKind
+
+	// The ID of the rule with the problem
+	RuleID string
+
+	// The position of the problem in the rule's expression; the line and
+	// column start at 1. Zero if the problem is not in a part of the expression.
+	Line   int
+	Column int
+
+	// A description of the problem
+	Message string
+}
+
+// String returns the finding as "rule ID: line:column: message".
+func (f Finding) String() string {
+	if f.Line == 0 {
+		return fmt.Sprintf("rule %s: %s", f.RuleID, f.Message)
+	}
+	return fmt.Sprintf("rule %s: %d:%d: %s", f.RuleID, f.Line, f.Column, f.Message)
+}
+
+// Lint checks the rule and its children for problems that do not prevent the
+// rules from compiling, but are likely to be mistakes:
+//
+//   - comparisons that are always true or always false
+//   - data elements in a schema that no rule using the schema refers to
+//   - child rules that are never evaluated, because the parent stops at the
+//     first passing (or failing) child, and a rule before them always passes
+//     (or fails), or because the parent's expression is always false and the
+//     parent has the StopIfParentNegative option
+//   - rules with the same expression as a sibling
+//   - fields selected from maps or dynamically typed values, which are not
+//     declared in the schema, without a has() check
+//
+// Only the evaluation options set on the rules are considered, not options
+// passed to Eval.
+//
+// The findings are returned in rule tree order. Lint returns an error if an
+// expression does not compile.
+func Lint(r *indigo.Rule) ([]Finding, error) {
+	if r == nil {
+		return nil, fmt.Errorf("rule is nil")
+	}
+
+	l := &linter{
+		exprs: map[*indigo.Rule]*lintedExpr{},
+		order: map[string]int{},
+		uses:  map[string]*schemaUse{},
+	}
+	if err := l.lintRule(r, indigo.Schema{}, nil); err != nil {
+		return nil, err
+	}
+	l.unusedElements()
+
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		return l.order[l.findings[i].RuleID] < l.order[l.findings[j].RuleID]
+	})
+	return l.findings, nil
+}
+
+// linter holds the state of a call to Lint.
+type linter struct {
+	findings []Finding
+
+	// the parsed and checked expressions of the rules
+	exprs map[*indigo.Rule]*lintedExpr
+
+	// the position of each rule ID in the rule tree, to sort findings
+	order map[string]int
+
+	// the schemas used by the rules, by key, in the order they were found
+	uses    map[string]*schemaUse
+	useList []*schemaUse
+}
+
+// lintedExpr is a rule's expression, parsed and checked.
+type lintedExpr struct {
+	ast     *celgo.Ast
+	env     *celgo.Env
+	checked *gexpr.CheckedExpr
+
+	// the expression with normalized formatting
+	normalized string
+
+	// the value of the expression if it is the same for all data; nil otherwise
+	constant *bool
+
+	// the names of the data elements in the rule's schema
+	elements map[string]bool
+}
+
+// schemaUse records the data elements of a schema (or the extra elements
+// of a rule) used by the rules.
+type schemaUse struct {
+	ruleID   string
+	name     string
+	extra    bool
+	elements []indigo.DataElement
+	used     map[string]bool
+}
+
+func (l *linter) add(f Finding) {
+	l.findings = append(l.findings, f)
+}
+
+// lintRule checks the rule and its children, given the effective schema of
+// the rule's parent and the schemas that provide its data elements.
+func (l *linter) lintRule(r *indigo.Rule, inherited indigo.Schema, uses []*schemaUse) error {
+	if _, ok := l.order[r.ID]; !ok {
+		l.order[r.ID] = len(l.order)
+	}
+
+	schema, err := r.ResolveSchema(inherited)
+	if err != nil {
+		return err
+	}
+	uses = l.schemaUses(r, uses)
+	x, err := l.parse(r, schema)
+	if err != nil {
+		return err
+	}
+	if x != nil {
+		l.exprs[r] = x
+		markUsed(uses, x)
+		if !x.usesData(x.checked.Expr) {
+			x.constant = x.evalBool(x.checked.Expr)
+		}
+		l.comparisons(r, x)
+		l.undeclaredFields(r, x)
+	}
+
+	for _, c := range r.Children() {
+		if err := l.lintRule(c, schema, uses); err != nil {
+			return err
+		}
+	}
+
+	l.unreachable(r)
+	l.duplicates(r)
+	return nil
+}
+
+// parse parses and checks the rule's expression against its schema. Returns
+// nil for rules without an expression.
+func (l *linter) parse(r *indigo.Rule, schema indigo.Schema) (*lintedExpr, error) {
+	if r.Expr == "" {
+		return nil, nil
+	}
+
+	schema, err := r.ExpressionSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := celEnv(schema)
+	if err != nil {
+		return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+	}
+
+	ast, iss := env.Compile(r.Expr)
+	if iss != nil && iss.Err() != nil {
+		return nil, fmt.Errorf("rule %s: %w", r.ID, iss.Err())
+	}
+
+	checked, err := celgo.AstToCheckedExpr(ast)
+	if err != nil {
+		return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+	}
+
+	x := &lintedExpr{
+		ast:      ast,
+		env:      env,
+		checked:  checked,
+		elements: map[string]bool{},
+	}
+	for _, e := range schema.Elements {
+		x.elements[e.Name] = true
+	}
+	x.normalized = x.unparse(checked.Expr)
+	return x, nil
+}
+
+// markUsed records the data elements the rule's expression refers to.
+func markUsed(uses []*schemaUse, x *lintedExpr) {
+	for _, u := range uses {
+		for _, ref := range x.checked.ReferenceMap {
+			if ref.GetName() != "" {
+				u.used[ref.GetName()] = true
+			}
+		}
+	}
+}
+
+// schemaUses returns the schemas that provide the data elements of the rule,
+// given those of its parent: the rule's own schema, or the one inherited from
+// the nearest ancestor with a schema, and the extra elements of the rule and
+// its ancestors.
+func (l *linter) schemaUses(r *indigo.Rule, inherited []*schemaUse) []*schemaUse {
+	uses := inherited
+	if s := r.Schema; s.ID != "" || len(s.Elements) > 0 {
+		// Schemas are identified by their ID, or by their elements if they
+		// have no ID, so that rules sharing a copy of a schema count as
+		// using the same schema
+		key := "id:" + s.ID
+		if s.ID == "" {
+			l := make([]string, 0, len(s.Elements))
+			for _, e := range s.Elements {
+				l = append(l, e.String())
+			}
+			key = "elements:" + strings.Join(l, ",")
+		}
+
+		u, ok := l.uses[key]
+		if !ok {
+			u = &schemaUse{ruleID: r.ID, name: s.ID, elements: s.Elements, used: map[string]bool{}}
+			l.uses[key] = u
+			l.useList = append(l.useList, u)
+		}
+		uses = []*schemaUse{u}
+	}
+
+	if len(r.ExtraElements) > 0 {
+		u := &schemaUse{ruleID: r.ID, extra: true, elements: r.ExtraElements, used: map[string]bool{}}
+		l.useList = append(l.useList, u)
+		uses = append(append([]*schemaUse(nil), uses...), u)
+	}
+	return uses
+}
+
+// unusedElements reports the data elements no rule refers to.
+func (l *linter) unusedElements() {
+	for _, u := range l.useList {
+		for _, e := range u.elements {
+			if u.used[e.Name] {
+				continue
+			}
+			var msg string
+			switch {
+			case u.extra:
+				msg = fmt.Sprintf("extra data element %s is not used by the rule or its children", e.Name)
+			case u.name != "":
+				msg = fmt.Sprintf("data element %s of schema %s is not used by any rule", e.Name, u.name)
+			default:
+				msg = fmt.Sprintf("data element %s is not used by any rule", e.Name)
+			}
+			l.add(Finding{Kind: UnusedElement, RuleID: u.ruleID, Message: msg})
+		}
+	}
+}
+
+// comparisons reports comparisons that are always true or always false.
+func (l *linter) comparisons(r *indigo.Rule, x *lintedExpr) {
+	walkExpr(x.checked.Expr, func(e *gexpr.Expr) {
+		call := e.GetCallExpr()
+		if call == nil || len(call.Args) != 2 {
+			return
+		}
+
+		// comparing an expression with itself
+		self := map[string]bool{
+			operators.Equals:        true,
+			operators.LessEquals:    true,
+			operators.GreaterEquals: true,
+			operators.NotEquals:     false,
+			operators.Less:          false,
+			operators.Greater:       false,
+		}
+		always, ok := self[call.Function]
+		if !ok {
+			return
+		}
+
+		var value *bool
+		switch {
+		case !x.usesData(e):
+			value = x.evalBool(e)
+		case x.unparse(call.Args[0]) == x.unparse(call.Args[1]):
+			value = &always
+		}
+		if value == nil {
+			return
+		}
+
+		if e == x.checked.Expr {
+			x.constant = value
+		}
+
+		line, col := x.location(e)
+		l.add(Finding{
+			Kind:    ConstantComparison,
+			RuleID:  r.ID,
+			Line:    line,
+			Column:  col,
+			Message: fmt.Sprintf("comparison %s is always %t", x.unparse(e), *value),
+		})
+	})
+}
+
+// undeclaredFields reports fields selected from maps and dynamically typed
+// values without a has() check.
+func (l *linter) undeclaredFields(r *indigo.Rule, x *lintedExpr) {
+	// the fields checked with has()
+	checked := map[string]bool{}
+	walkExpr(x.checked.Expr, func(e *gexpr.Expr) {
+		if s := e.GetSelectExpr(); s != nil && s.TestOnly {
+			checked[x.unparse(s.Operand)+"."+s.Field] = true
+		}
+	})
+
+	walkExpr(x.checked.Expr, func(e *gexpr.Expr) {
+		s := e.GetSelectExpr()
+		if s == nil || s.TestOnly {
+			return
+		}
+
+		t := x.checked.TypeMap[s.Operand.Id]
+		if t.GetMapType() == nil && t.GetDyn() == nil {
+			return
+		}
+
+		// the results of dependencies always have the fields
+		if len(r.DependsOn) > 0 && rootIdent(s.Operand) == indigo.RulesKey {
+			return
+		}
+
+		field := x.unparse(s.Operand) + "." + s.Field
+		if checked[field] {
+			return
+		}
+
+		line, col := x.location(e)
+		l.add(Finding{
+			Kind:    UndeclaredField,
+			RuleID:  r.ID,
+			Line:    line,
+			Column:  col,
+			Message: fmt.Sprintf("field %s is not declared in the schema, and evaluation fails if it is missing; check it with has(%s)", field, field),
+		})
+	})
+}
+
+// unreachable reports the child rules of r that are never evaluated.
+func (l *linter) unreachable(r *indigo.Rule) {
+	children := r.Children()
+
+	if r.EvalOptions.StopIfParentNegative {
+		if x := l.exprs[r]; x != nil && x.constant != nil && !*x.constant {
+			for _, c := range children {
+				l.add(Finding{
+					Kind:    UnreachableRule,
+					RuleID:  c.ID,
+					Message: fmt.Sprintf("rule is never evaluated: the expression of parent rule %s is always false, and it has the StopIfParentNegative option", r.ID),
+				})
+			}
+			return
+		}
+	}
+
+	stop := map[bool]bool{
+		true:  r.EvalOptions.StopFirstPositiveChild,
+		false: r.EvalOptions.StopFirstNegativeChild,
+	}
+	for i, c := range children {
+		pass := l.constantPass(c)
+		if pass == nil || !stop[*pass] {
+			continue
+		}
+
+		option, outcome := "StopFirstPositiveChild", "passes"
+		if !*pass {
+			option, outcome = "StopFirstNegativeChild", "fails"
+		}
+		for _, u := range children[i+1:] {
+			l.add(Finding{
+				Kind:    UnreachableRule,
+				RuleID:  u.ID,
+				Message: fmt.Sprintf("rule is never evaluated: parent rule %s has the %s option, and rule %s before it always %s", r.ID, option, c.ID, outcome),
+			})
+		}
+		return
+	}
+}
+
+// constantPass returns whether the rule always passes or always fails, or
+// nil if that depends on the data.
+func (l *linter) constantPass(r *indigo.Rule) *bool {
+	if r.Disabled || !r.EffectiveFrom.IsZero() || !r.EffectiveUntil.IsZero() {
+		return nil
+	}
+
+	pass := true
+	if x := l.exprs[r]; x != nil {
+		if x.constant == nil {
+			return nil
+		}
+		pass = *x.constant
+	}
+
+	if !pass || len(r.Rules) == 0 {
+		return &pass
+	}
+
+	// with the default options, the rule passes if all of its children pass
+	o := r.EvalOptions
+	if o.TrueIfAny || o.RollUp != indigo.RollUpAll || o.HitPolicy != indigo.HitPolicyNone ||
+		o.StopFirstPositiveChild || o.StopFirstNegativeChild {
+		return nil
+	}
+	for _, c := range r.Rules {
+		p := l.constantPass(c)
+		if p == nil {
+			return nil
+		}
+		if !*p {
+			return p
+		}
+	}
+	return &pass
+}
+
+// duplicates reports child rules of r with the same expression as a sibling
+// evaluated before them.
+func (l *linter) duplicates(r *indigo.Rule) {
+	seen := map[string]string{}
+	for _, c := range r.Children() {
+		x := l.exprs[c]
+		if x == nil {
+			continue
+		}
+		if id, ok := seen[x.normalized]; ok {
+			l.add(Finding{
+				Kind:    DuplicateExpression,
+				RuleID:  c.ID,
+				Message: fmt.Sprintf("rule has the same expression as sibling rule %s", id),
+			})
+			continue
+		}
+		seen[x.normalized] = c.ID
+	}
+}
+
+// unparse returns the source of the expression, with normalized formatting.
+func (x *lintedExpr) unparse(e *gexpr.Expr) string {
+	s, err := parser.Unparse(e, x.checked.SourceInfo)
+	if err != nil {
+		return fmt.Sprintf("expr(%d)", e.Id)
+	}
+	return s
+}
+
+// usesData reports whether the expression refers to any data element.
+func (x *lintedExpr) usesData(e *gexpr.Expr) bool {
+	uses := false
+	walkExpr(e, func(c *gexpr.Expr) {
+		if ref, ok := x.checked.ReferenceMap[c.Id]; ok && x.elements[ref.GetName()] {
+			uses = true
+		}
+		if id := c.GetIdentExpr(); id != nil && x.elements[id.Name] {
+			uses = true
+		}
+	})
+	return uses
+}
+
+// evalBool evaluates an expression that does not use any data, returning
+// nil if it does not produce a boolean.
+func (x *lintedExpr) evalBool(e *gexpr.Expr) *bool {
+	ast, iss := x.env.Compile(x.unparse(e))
+	if iss != nil && iss.Err() != nil {
+		return nil
+	}
+	prg, err := x.env.Program(ast)
+	if err != nil {
+		return nil
+	}
+	out, _, err := prg.Eval(map[string]interface{}{})
+	if err != nil {
+		return nil
+	}
+	b, ok := out.Value().(bool)
+	if !ok {
+		return nil
+	}
+	return &b
+}
+
+// location returns the line and column (starting at 1) of the expression in
+// the source, or zeros if unknown.
+func (x *lintedExpr) location(e *gexpr.Expr) (int, int) {
+	offset, ok := x.checked.SourceInfo.GetPositions()[e.Id]
+	if !ok {
+		return 0, 0
+	}
+	loc, ok := x.ast.Source().OffsetLocation(offset)
+	if !ok {
+		return 0, 0
+	}
+	return loc.Line(), loc.Column() + 1
+}
+
+// rootIdent returns the identifier at the root of a chain of field
+// selections, such as a in a.b.c, or a blank string.
+func rootIdent(e *gexpr.Expr) string {
+	for {
+		switch {
+		case e.GetSelectExpr() != nil:
+			e = e.GetSelectExpr().Operand
+		case e.GetIdentExpr() != nil:
+			return e.GetIdentExpr().Name
+		default:
+			return ""
+		}
+	}
+}
+
+// walkExpr calls fn for the expression and each of its subexpressions.
+func walkExpr(e *gexpr.Expr, fn func(e *gexpr.Expr)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	for _, c := range children(e) {
+		walkExpr(c, fn)
+	}
+}
+
+// children returns the direct subexpressions of the expression.
+func children(e *gexpr.Expr) []*gexpr.Expr {
+	switch k := e.ExprKind.(type) {
+	case *gexpr.Expr_SelectExpr:
+		return []*gexpr.Expr{k.SelectExpr.Operand}
+	case *gexpr.Expr_CallExpr:
+		l := []*gexpr.Expr{}
+		if k.CallExpr.Target != nil {
+			l = append(l, k.CallExpr.Target)
+		}
+		return append(l, k.CallExpr.Args...)
+	case *gexpr.Expr_ListExpr:
+		return k.ListExpr.Elements
+	case *gexpr.Expr_StructExpr:
+		l := []*gexpr.Expr{}
+		for _, en := range k.StructExpr.Entries {
+			if en.GetMapKey() != nil {
+				l = append(l, en.GetMapKey())
+			}
+			l = append(l, en.Value)
+		}
+		return l
+	case *gexpr.Expr_ComprehensionExpr:
+		c := k.ComprehensionExpr
+		return []*gexpr.Expr{c.IterRange, c.AccuInit, c.LoopCondition, c.LoopStep, c.Result}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package cel_test
+
+import (
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/matryer/is"
+)
+
+func TestLint(t *testing.T) {
+	is := is.New(t)
+
+	schema := indigo.Schema{
+		ID: "orders",
+		Elements: []indigo.DataElement{
+			{Name: "total", Type: indigo.Float{}},
+			{Name: "region", Type: indigo.String{}},
+			{Name: "tags", Type: indigo.Map{KeyType: indigo.String{}, ValueType: indigo.String{}}},
+			{Name: "legacy", Type: indigo.Int{}},
+		},
+	}
+
+	root := &indigo.Rule{
+		ID:     "root",
+		Schema: schema,
+		EvalOptions: indigo.EvalOptions{
+			StopFirstPositiveChild: true,
+		},
+		Rules: map[string]*indigo.Rule{
+			"a_big": {
+				ID:   "a_big",
+				Expr: "total > 100.0 && 1 < 2",
+			},
+			"b_always": {
+				ID:   "b_always",
+				Expr: "region == region",
+			},
+			"c_tagged": {
+				ID:            "c_tagged",
+				Expr:          `tags.priority == "high" && (has(tags.vip) && tags.vip == "yes")`,
+				ExtraElements: []indigo.DataElement{{Name: "unused_extra", Type: indigo.Bool{}}},
+			},
+			"d_copy": {
+				ID:   "d_copy",
+				Expr: "total>100.0&&1<2",
+			},
+		},
+	}
+
+	engine := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(engine.Compile(root))
+
+	findings, err := cel.Lint(root)
+	is.NoErr(err)
+
+	byKind := map[cel.FindingKind][]cel.Finding{}
+	for _, f := range findings {
+		byKind[f.Kind] = append(byKind[f.Kind], f)
+	}
+
+	// 1 < 2 in a_big and d_copy, region == region in b_always
+	is.Equal(len(byKind[cel.ConstantComparison]), 3)
+	f := byKind[cel.ConstantComparison][0]
+	is.Equal(f.RuleID, "a_big")
+	is.Equal(f.Line, 1)
+	is.Equal(f.Column, 20)
+	is.Equal(f.Message, "comparison 1 < 2 is always true")
+	is.Equal(byKind[cel.ConstantComparison][1].RuleID, "b_always")
+	is.Equal(byKind[cel.ConstantComparison][1].Message, "comparison region == region is always true")
+
+	is.Equal(len(byKind[cel.UnusedElement]), 2)
+	is.Equal(byKind[cel.UnusedElement][0].RuleID, "root")
+	is.Equal(byKind[cel.UnusedElement][0].Message, "data element legacy of schema orders is not used by any rule")
+	is.Equal(byKind[cel.UnusedElement][1].RuleID, "c_tagged")
+
+	// b_always always passes, so c_tagged and d_copy are never evaluated
+	is.Equal(len(byKind[cel.UnreachableRule]), 2)
+	is.Equal(byKind[cel.UnreachableRule][0].RuleID, "c_tagged")
+	is.Equal(byKind[cel.UnreachableRule][1].RuleID, "d_copy")
+
+	is.Equal(len(byKind[cel.DuplicateExpression]), 1)
+	is.Equal(byKind[cel.DuplicateExpression][0].RuleID, "d_copy")
+
+	// tags.vip is checked with has(), tags.priority is not
+	is.Equal(len(byKind[cel.UndeclaredField]), 1)
+	f = byKind[cel.UndeclaredField][0]
+	is.Equal(f.RuleID, "c_tagged")
+	is.Equal(f.Line, 1)
+	is.Equal(f.Column, 5)
+
+	// findings are in rule tree order, starting with the root
+	is.Equal(findings[0].RuleID, "root")
+	is.Equal(findings[len(findings)-1].RuleID, "d_copy")
+}
+
+func TestLintClean(t *testing.T) {
+	is := is.New(t)
+
+	root := &indigo.Rule{
+		ID: "root",
+		Schema: indigo.Schema{
+			Elements: []indigo.DataElement{
+				{Name: "x", Type: indigo.Int{}},
+			},
+		},
+		EvalOptions: indigo.EvalOptions{
+			StopIfParentNegative: true,
+		},
+		Rules: map[string]*indigo.Rule{
+			"small": {ID: "small", Expr: "x < 10"},
+			"large": {ID: "large", Expr: "x > 100"},
+		},
+	}
+
+	findings, err := cel.Lint(root)
+	is.NoErr(err)
+	is.Equal(len(findings), 0)
+
+	// a parent that is always false with StopIfParentNegative
+	root.Expr = "1 == 2"
+	findings, err = cel.Lint(root)
+	is.NoErr(err)
+	is.Equal(len(findings), 3)
+	is.Equal(findings[0].String(), "rule root: 1:3: comparison 1 == 2 is always false")
+	is.Equal(findings[1].Kind, cel.UnreachableRule)
+
+	root.Expr = "x +"
+	_, err = cel.Lint(root)
+	is.True(err != nil)
+}
+
+// Lint resolves schemas as Compile does, and fails where Compile fails
+func TestLintSchemaErrors(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+
+	// an extra element already in the inherited schema
+	root := &indigo.Rule{
+		ID:     "root",
+		Schema: indigo.Schema{Elements: []indigo.DataElement{{Name: "x", Type: indigo.Int{}}}},
+		Rules: map[string]*indigo.Rule{
+			"child": {ID: "child", Expr: "x > 1", ExtraElements: []indigo.DataElement{{Name: "x", Type: indigo.Int{}}}},
+		},
+	}
+	_, err := cel.Lint(root)
+	is.True(err != nil)
+	is.True(e.Compile(root) != nil)
+
+	// a schema element with the name reserved for the results of dependencies
+	root = &indigo.Rule{
+		ID:     "root",
+		Schema: indigo.Schema{Elements: []indigo.DataElement{{Name: indigo.RulesKey, Type: indigo.Int{}}}},
+		Rules: map[string]*indigo.Rule{
+			"a": {ID: "a", Expr: "true"},
+			"b": {ID: "b", Expr: "rules.a.pass", DependsOn: []string{"a"}},
+		},
+	}
+	_, err = cel.Lint(root)
+	is.True(err != nil)
+	is.True(e.Compile(root) != nil)
+}
@@ -0,0 +1,215 @@
+package cel
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/ezachrisen/indigo"
+
+	celgo "github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/operators"
+	gexpr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// References is the input data an expression refers to.
+type References struct {
+	// The names of the schema elements, sorted
+	Elements []string
+
+	// The paths of the fields selected from the elements, sorted, such as
+	// student.grades or student.attrs["major"]. A path ends where a field is
+	// selected with a key or index that is not a constant. An element used
+	// without selecting a field is its own path.
+	Fields []string
+}
+
+// RuleReferences is the input data referred to by a rule and its child rules.
+type RuleReferences struct {
+	RuleID string
+
+	// The data referred to by the rule's expression
+	Rule References
+
+	// The data referred to by the rule and all of its descendants
+	Subtree References
+
+	// The references of the child rules, by rule ID
+	Rules map[string]*RuleReferences
+}
+
+// References reports the schema elements and fields the rule and each of its
+// child rules refer to, so that callers can fetch only the input data the
+// rules use, or audit which data the rules access.
+//
+// The rules must have been compiled by the evaluator. Only data elements
+// declared in the rule's schema (or the evaluator's FixedSchema) are
+// reported; the results of dependencies and the parameters of templates are
+// not input data.
+func (e *Evaluator) References(r *indigo.Rule) (*RuleReferences, error) {
+	if r == nil {
+		return nil, fmt.Errorf("rule is nil")
+	}
+
+	rr := &RuleReferences{
+		RuleID: r.ID,
+		Rules:  make(map[string]*RuleReferences, len(r.Rules)),
+	}
+
+	if r.Expr != "" {
+		prog, ok := r.Program.(celProgram)
+		if !ok || prog.checked == nil {
+			return nil, fmt.Errorf("rule %s: missing program; the rule must be compiled", r.ID)
+		}
+
+		schema := r.EffectiveSchema()
+		if e.fixedSchema != nil {
+			schema = *e.fixedSchema
+		}
+
+		refs, err := expressionReferences(prog.checked, schema)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+		rr.Rule = refs
+	}
+
+	subtree := []References{rr.Rule}
+	for id, c := range r.Rules {
+		cr, err := e.References(c)
+		if err != nil {
+			return nil, err
+		}
+		rr.Rules[id] = cr
+		subtree = append(subtree, cr.Subtree)
+	}
+	rr.Subtree = mergeReferences(subtree...)
+	return rr, nil
+}
+
+// expressionReferences returns the elements of the schema and the field
+// paths the checked expression refers to.
+func expressionReferences(ast *celgo.Ast, schema indigo.Schema) (References, error) {
+	checked, err := celgo.AstToCheckedExpr(ast)
+	if err != nil {
+		return References{}, err
+	}
+
+	c := refCollector{
+		refs:     checked.ReferenceMap,
+		declared: make(map[string]bool, len(schema.Elements)),
+		elements: map[string]bool{},
+		fields:   map[string]bool{},
+	}
+	for _, el := range schema.Elements {
+		c.declared[el.Name] = true
+	}
+	c.collect(checked.Expr)
+
+	return References{
+		Elements: sortedKeys(c.elements),
+		Fields:   sortedKeys(c.fields),
+	}, nil
+}
+
+// refCollector finds the elements and field paths used in an expression.
+type refCollector struct {
+	// the references resolved by the type checker, by expression ID
+	refs map[int64]*gexpr.Reference
+
+	// the names of the elements in the schema
+	declared map[string]bool
+
+	elements map[string]bool
+	fields   map[string]bool
+}
+
+// collect records the longest field paths in the expression.
+func (c *refCollector) collect(e *gexpr.Expr) {
+	if e == nil {
+		return
+	}
+	if path, element, ok := c.path(e); ok {
+		c.fields[path] = true
+		c.elements[element] = true
+		return
+	}
+	for _, ch := range children(e) {
+		c.collect(ch)
+	}
+}
+
+// path returns the field path the expression selects from a data element,
+// and the name of the element, if the expression is a chain of field
+// selections and constant indexes on an element.
+func (c *refCollector) path(e *gexpr.Expr) (string, string, bool) {
+	// The type checker resolves qualified element names, such as
+	// student.ID, to a reference on the outermost selection
+	if ref, ok := c.refs[e.Id]; ok && ref.GetValue() == nil && c.declared[ref.GetName()] {
+		return ref.GetName(), ref.GetName(), true
+	}
+
+	switch k := e.ExprKind.(type) {
+	case *gexpr.Expr_SelectExpr:
+		if p, el, ok := c.path(k.SelectExpr.Operand); ok {
+			return p + "." + k.SelectExpr.Field, el, true
+		}
+	case *gexpr.Expr_CallExpr:
+		call := k.CallExpr
+		if call.Function != operators.Index || len(call.Args) != 2 {
+			break
+		}
+		key, ok := constantKey(call.Args[1])
+		if !ok {
+			break
+		}
+		if p, el, ok := c.path(call.Args[0]); ok {
+			return p + "[" + key + "]", el, true
+		}
+	}
+	return "", "", false
+}
+
+// constantKey returns the map key or list index, written as a CEL literal,
+// if the expression is a constant.
+func constantKey(e *gexpr.Expr) (string, bool) {
+	switch k := e.GetConstExpr().GetConstantKind().(type) {
+	case *gexpr.Constant_StringValue:
+		return strconv.Quote(k.StringValue), true
+	case *gexpr.Constant_Int64Value:
+		return strconv.FormatInt(k.Int64Value, 10), true
+	case *gexpr.Constant_Uint64Value:
+		return strconv.FormatUint(k.Uint64Value, 10) + "u", true
+	case *gexpr.Constant_BoolValue:
+		return strconv.FormatBool(k.BoolValue), true
+	}
+	return "", false
+}
+
+// mergeReferences returns the union of the references.
+func mergeReferences(l ...References) References {
+	elements := map[string]bool{}
+	fields := map[string]bool{}
+	for _, x := range l {
+		for _, el := range x.Elements {
+			elements[el] = true
+		}
+		for _, f := range x.Fields {
+			fields[f] = true
+		}
+	}
+	return References{
+		Elements: sortedKeys(elements),
+		Fields:   sortedKeys(fields),
+	}
+}
+
+// sortedKeys returns the keys of the map in sorted order.
+func sortedKeys(m map[string]bool) []string {
+	l := make([]string, 0, len(m))
+	for k := range m {
+		l = append(l, k)
+	}
+	sort.Strings(l)
+	return l
+}
@@ -0,0 +1,53 @@
+package cel_test
+
+import (
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/matryer/is"
+)
+
+func TestReferences(t *testing.T) {
+	is := is.New(t)
+
+	r := makeEducationProtoRules("student_actions")
+	r.Rules["major"] = &indigo.Rule{
+		ID:     "major",
+		Expr:   `student.attrs["major"] == "Physics" && student.suspensions.exists(s, s.cause == "cheating")`,
+		Schema: makeEducationProtoSchema(),
+		Rules: map[string]*indigo.Rule{
+			"first_grade": {
+				ID:     "first_grade",
+				Expr:   `student.grades[0] > 3.0 && has(student.off_campus)`,
+				Schema: makeEducationProtoSchema(),
+			},
+		},
+	}
+
+	ev := cel.NewEvaluator()
+	e := indigo.NewEngine(ev)
+	is.NoErr(e.Compile(r))
+
+	refs, err := ev.References(r)
+	is.NoErr(err)
+
+	// the root has no expression
+	is.Equal(len(refs.Rule.Elements), 0)
+	is.Equal(refs.Subtree.Elements, []string{"now", "self", "student"})
+
+	honor := refs.Rules["honor_student"].Rule
+	is.Equal(honor.Elements, []string{"self", "student"})
+	is.Equal(honor.Fields, []string{"self.Minimum_GPA", "student.gpa", "student.grades", "student.status"})
+
+	major := refs.Rules["major"]
+	is.Equal(major.Rule.Fields, []string{`student.attrs["major"]`, "student.suspensions"})
+	is.Equal(major.Rules["first_grade"].Rule.Fields, []string{"student.grades[0]", "student.off_campus"})
+	is.Equal(major.Subtree.Fields, []string{`student.attrs["major"]`, "student.grades[0]", "student.off_campus", "student.suspensions"})
+
+	is.Equal(refs.Rules["tenure_gt_6months"].Rule.Fields, []string{"now", "student.enrollment_date"})
+
+	// the rules must be compiled
+	_, err = ev.References(makeEducationProtoRules("uncompiled"))
+	is.True(err != nil)
+}
@@ -0,0 +1,293 @@
+package indigo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Coerce returns a copy of the data with the values converted to the types
+// of the schema's elements, for data decoded from JSON into
+// map[string]interface{}, where numbers are float64 (or json.Number),
+// timestamps and durations are strings, and messages are generic maps:
+//
+//   - Int: integral numbers and numeric strings become int64
+//   - Float: numbers and numeric strings become float64
+//   - Bool: the strings "true" and "false" become bools
+//   - Timestamp: RFC 3339 strings become time.Time
+//   - Duration: strings such as "1h30m" or "1.5s", and integral numbers of
+//     nanoseconds (as encoding/json encodes a time.Duration), become
+//     time.Duration
+//   - List: each element is converted to the list's element type
+//   - Map: each key and value is converted to the map's key and value types
+//   - Proto: maps and JSON strings are converted to messages of the type
+//     with protojson
+//   - Struct: maps are converted to pointers to the struct with encoding/json,
+//     so the keys are the fields' JSON names (their json tags, or their Go
+//     names), not the names in their indigo tags (see SchemaFromStruct)
+//
+// Values that are already of the right type, values of Any elements, nil
+// values, and values for elements not in the schema are copied as they are.
+// Elements missing from the data are not added.
+//
+// Coerce returns an error naming the element, and the path of the value
+// within it (see Violation), for the first value that cannot be converted.
+// Use Validate to check the result.
+func (s *Schema) Coerce(d map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(d))
+	for k, v := range d {
+		out[k] = v
+	}
+
+	for _, e := range s.Elements {
+		v, ok := d[e.Name]
+		if !ok {
+			continue
+		}
+		if _, ok := v.(*LazyValue); ok {
+			continue
+		}
+
+		cv, err := coerceValue(e.Name, e.Type, v)
+		if err != nil {
+			return nil, err
+		}
+		out[e.Name] = cv
+	}
+	return out, nil
+}
+
+// coerceValue converts the value at the path to the type.
+func coerceValue(path string, typ Type, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	fail := func(err error) (interface{}, error) {
+		return nil, fmt.Errorf("data element %s: %w", path, err)
+	}
+
+	switch t := typ.(type) {
+	case Int:
+		i, err := coerceInt(v)
+		if err != nil {
+			return fail(err)
+		}
+		return i, nil
+	case Float:
+		f, err := coerceFloat(v)
+		if err != nil {
+			return fail(err)
+		}
+		return f, nil
+	case String:
+		if _, ok := v.(string); ok {
+			return v, nil
+		}
+	case Bool:
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case string:
+			b, err := strconv.ParseBool(x)
+			if err != nil {
+				return fail(err)
+			}
+			return b, nil
+		}
+	case Timestamp:
+		switch x := v.(type) {
+		case time.Time, *timestamppb.Timestamp:
+			return x, nil
+		case string:
+			ts, err := time.Parse(time.RFC3339Nano, x)
+			if err != nil {
+				return fail(err)
+			}
+			return ts, nil
+		}
+	case Duration:
+		switch x := v.(type) {
+		case time.Duration, *durationpb.Duration:
+			return x, nil
+		case string:
+			d, err := time.ParseDuration(x)
+			if err != nil {
+				return fail(err)
+			}
+			return d, nil
+		default:
+			// encoding/json encodes a time.Duration as nanoseconds
+			n, err := coerceInt(v)
+			if err != nil {
+				return fail(fmt.Errorf("cannot convert %v (%T) to %v", v, v, typ))
+			}
+			return time.Duration(n), nil
+		}
+	case Proto:
+		return coerceProto(path, t, v)
+	case Struct:
+		return coerceStruct(path, t, v)
+	case List:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			break
+		}
+		l := make([]interface{}, rv.Len())
+		for i := range l {
+			ev, err := coerceValue(fmt.Sprintf("%s[%d]", path, i), t.ValueType, rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			l[i] = ev
+		}
+		return l, nil
+	case Map:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Map {
+			break
+		}
+		m := make(map[interface{}]interface{}, rv.Len())
+		sm := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			kp := keyPath(path, k.Interface())
+			ck, err := coerceValue(kp+" (key)", t.KeyType, k.Interface())
+			if err != nil {
+				return nil, err
+			}
+			cv, err := coerceValue(kp, t.ValueType, rv.MapIndex(k).Interface())
+			if err != nil {
+				return nil, err
+			}
+			m[ck] = cv
+			if ks, ok := ck.(string); ok {
+				sm[ks] = cv
+			}
+		}
+
+		// maps with string keys, such as JSON objects, keep their type
+		if _, ok := t.KeyType.(String); ok {
+			return sm, nil
+		}
+		return m, nil
+	case Any:
+		return v, nil
+	default:
+		return fail(fmt.Errorf("unsupported type %v", typ))
+	}
+	return fail(fmt.Errorf("cannot convert %v (%T) to %v", v, v, typ))
+}
+
+// coerceInt converts integers, integral floats and numeric strings to int64.
+func coerceInt(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case json.Number:
+		return x.Int64()
+	case string:
+		return strconv.ParseInt(x, 10, 64)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot convert %v (%T) to int", v, v)
+}
+
+// coerceFloat converts numbers and numeric strings to float64.
+func coerceFloat(v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case json.Number:
+		return x.Float64()
+	case string:
+		return strconv.ParseFloat(x, 64)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	}
+	return 0, fmt.Errorf("cannot convert %v (%T) to float", v, v)
+}
+
+// coerceProto converts a map or a JSON string to a message of the Proto type,
+// using protojson.
+func coerceProto(path string, t Proto, v interface{}) (interface{}, error) {
+	want, err := t.ProtoFullName()
+	if err != nil {
+		return nil, fmt.Errorf("data element %s: %w", path, err)
+	}
+
+	var b []byte
+	switch x := v.(type) {
+	case proto.Message:
+		if got := string(x.ProtoReflect().Descriptor().FullName()); got != want {
+			return nil, fmt.Errorf("data element %s: proto message %s is not of type %v", path, got, t)
+		}
+		return x, nil
+	case string:
+		b = []byte(x)
+	case map[string]interface{}:
+		if b, err = json.Marshal(x); err != nil {
+			return nil, fmt.Errorf("data element %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("data element %s: cannot convert %v (%T) to %v", path, v, v, t)
+	}
+
+	m := t.Message.ProtoReflect().New().Interface()
+	if err := protojson.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("data element %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// coerceStruct converts a map to a pointer to the Struct type, using
+// encoding/json. The keys of the map are the JSON names of the fields.
+func coerceStruct(path string, t Struct, v interface{}) (interface{}, error) {
+	st, err := t.StructType()
+	if err != nil {
+		return nil, fmt.Errorf("data element %s: %w", path, err)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Type() == st || (rv.Kind() == reflect.Pointer && rv.Type().Elem() == st) {
+		return v, nil
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("data element %s: cannot convert %v (%T) to %v", path, v, v, t)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("data element %s: %w", path, err)
+	}
+	p := reflect.New(st)
+	if err := json.Unmarshal(b, p.Interface()); err != nil {
+		return nil, fmt.Errorf("data element %s: %w", path, err)
+	}
+	return p.Interface(), nil
+}
@@ -0,0 +1,118 @@
+package indigo_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/ezachrisen/indigo/testdata/school"
+	"github.com/matryer/is"
+)
+
+func TestCoerce(t *testing.T) {
+	is := is.New(t)
+
+	s := indigo.Schema{
+		Elements: []indigo.DataElement{
+			{Name: "student", Type: indigo.Proto{Message: &school.Student{}}},
+			{Name: "age", Type: indigo.Int{}},
+			{Name: "gpa", Type: indigo.Float{}},
+			{Name: "enrolled", Type: indigo.Timestamp{}},
+			{Name: "tenure", Type: indigo.Duration{}},
+			{Name: "scores", Type: indigo.Map{KeyType: indigo.String{}, ValueType: indigo.List{ValueType: indigo.Int{}}}},
+			{Name: "by_year", Type: indigo.Map{KeyType: indigo.Int{}, ValueType: indigo.String{}}},
+			{Name: "honors", Type: indigo.Bool{}},
+		},
+	}
+
+	input := `{
+		"student": {"gpa": 3.8, "grades": [4, 3.5], "enrollmentDate": "2020-01-01T00:00:00Z", "attrs": {"major": "Physics"}},
+		"age": 17,
+		"gpa": 4,
+		"enrolled": "2020-09-01T08:00:00Z",
+		"tenure": "720h",
+		"scores": {"math": [90, 85]},
+		"by_year": {"2021": "freshman"},
+		"honors": "true",
+		"other": 1.5
+	}`
+
+	d := map[string]interface{}{}
+	is.NoErr(json.Unmarshal([]byte(input), &d))
+	is.True(len(s.Validate(d)) > 0)
+
+	c, err := s.Coerce(d)
+	is.NoErr(err)
+	is.Equal(len(s.Validate(c)), 0)
+
+	is.Equal(c["age"], int64(17))
+	is.Equal(c["gpa"], 4.0)
+	is.Equal(c["enrolled"], time.Date(2020, 9, 1, 8, 0, 0, 0, time.UTC))
+	is.Equal(c["tenure"], 720*time.Hour)
+	is.Equal(c["scores"], map[string]interface{}{"math": []interface{}{int64(90), int64(85)}})
+	is.Equal(c["by_year"], map[interface{}]interface{}{int64(2021): "freshman"})
+	is.Equal(c["honors"], true)
+	is.Equal(c["other"], 1.5)
+	is.Equal(c["student"].(*school.Student).Attrs["major"], "Physics")
+
+	// the input data is not changed
+	is.Equal(d["age"], 17.0)
+
+	// the coerced data can be evaluated
+	r := &indigo.Rule{
+		ID:     "physics_honors",
+		Schema: s,
+		Expr:   `student.attrs["major"] == "Physics" && age < 18 && scores.math[0] > 80 && by_year[2021] == "freshman" && honors`,
+	}
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(r))
+	u, err := e.Eval(context.Background(), r, c)
+	is.NoErr(err)
+	is.True(u.Pass)
+
+	// errors include the path of the value
+	d["scores"] = map[string]interface{}{"math": []interface{}{90.0, 85.5}}
+	_, err = s.Coerce(d)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), `data element scores["math"][1]: cannot convert 85.5 (float64) to int`))
+
+	d["scores"] = map[string]interface{}{}
+	d["student"] = map[string]interface{}{"gpa": "high"}
+	_, err = s.Coerce(d)
+	is.True(err != nil)
+	is.True(strings.HasPrefix(err.Error(), "data element student:"))
+}
+
+// The keys of an object coerced to a struct are the fields' JSON names, while
+// the struct's indigo tags name the data elements
+func TestCoerceStructNames(t *testing.T) {
+	is := is.New(t)
+
+	type item struct {
+		SKU   string  `indigo:"sku" json:"item_code"`
+		Price float64 `indigo:"unit_price" json:"price"`
+	}
+	type basket struct {
+		First item   `indigo:"first_item" json:"first"`
+		Items []item `indigo:"items"`
+	}
+
+	s, err := indigo.SchemaFromStruct(basket{})
+	is.NoErr(err)
+	is.Equal(s.Elements[0].Name, "first_item")
+
+	d := map[string]interface{}{}
+	is.NoErr(json.Unmarshal([]byte(`{
+		"first_item": {"item_code": "A1", "price": 2.5, "unit_price": 9},
+		"items": [{"item_code": "B2", "price": 1}]
+	}`), &d))
+
+	c, err := s.Coerce(d)
+	is.NoErr(err)
+	is.Equal(c["first_item"], &item{SKU: "A1", Price: 2.5})
+	is.Equal(c["items"], []interface{}{&item{SKU: "B2", Price: 1}})
+}
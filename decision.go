@@ -0,0 +1,466 @@
+package indigo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Decision is a record of an evaluation of a rule tree, with enough
+// information to reproduce it later. Use the RecordDecisions option to
+// record decisions and Replay to re-evaluate them.
+type Decision struct {
+	// When the evaluation happened
+	Time time.Time `json:"time"`
+
+	// The ID, version and content hash of the root rule evaluated
+	RuleID      string `json:"rule_id"`
+	RuleVersion string `json:"rule_version,omitempty"`
+	RuleHash    string `json:"rule_hash,omitempty"`
+
+	// The input data, one JSON value per data element. Protocol buffer
+	// messages are encoded with protojson. Elements resolved by a
+	// DataProvider are only included if they were used.
+	Data map[string]json.RawMessage `json:"data"`
+
+	// The evaluation options of the root rule, including any options passed to Eval
+	EvalOptions EvalOptions `json:"eval_options"`
+
+	// The names of the evaluation options that were passed to Eval, such as
+	// StopFirstPositiveChild: the fields of EvalOptions that differ from the
+	// root rule's own options. Replay passes them to Eval again.
+	Overrides []string `json:"overrides,omitempty"`
+
+	// The results of the evaluation. When a decision is read back, the
+	// result is decoded as described in Result.UnmarshalJSON.
+	Result *Result `json:"result"`
+}
+
+// DecisionSink is the interface that wraps the Record method.
+// Record is called once for each evaluation of a rule tree with the
+// RecordDecisions option set. It must be safe for concurrent use.
+type DecisionSink interface {
+	Record(d *Decision) error
+}
+
+// JSONLinesSink is a DecisionSink that writes each decision as a line of JSON.
+type JSONLinesSink struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewJSONLinesSink returns a sink that writes decisions to w.
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{
+		w:   w,
+		enc: json.NewEncoder(w),
+	}
+}
+
+// OpenJSONLinesFile opens (or creates) the named file and returns a sink that
+// appends decisions to it. Call Close to close the file.
+func OpenJSONLinesFile(name string) (*JSONLinesSink, error) {
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLinesSink(f), nil
+}
+
+// Record writes the decision as a line of JSON.
+func (s *JSONLinesSink) Record(d *Decision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(d)
+}
+
+// Close closes the underlying writer, if it is an io.Closer.
+func (s *JSONLinesSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// ReadDecisions reads decisions written by a JSONLinesSink.
+func ReadDecisions(r io.Reader) ([]*Decision, error) {
+	decisions := []*Decision{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		d := &Decision{}
+		if err := json.Unmarshal(sc.Bytes(), d); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		decisions = append(decisions, d)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return decisions, nil
+}
+
+// recordDecision sends a record of the evaluation of rule r at time t to the
+// sink.
+func recordDecision(sink DecisionSink, r *Rule, d map[string]interface{}, u *Result, t time.Time) error {
+	data := make(map[string]json.RawMessage, len(d))
+	for k, v := range d {
+		if k == selfKey {
+			continue
+		}
+		// only the elements the provider resolved were used
+		if lv, ok := v.(*LazyValue); ok {
+			if v, ok = lv.resolved(); !ok {
+				continue
+			}
+		}
+		b, err := encodeValue(v)
+		if err != nil {
+			return fmt.Errorf("encoding data element %s: %w", k, err)
+		}
+		data[k] = b
+	}
+
+	return sink.Record(&Decision{
+		Time:        t,
+		RuleID:      r.ID,
+		RuleVersion: r.Version,
+		RuleHash:    r.hash,
+		Data:        data,
+		EvalOptions: u.EvalOptions,
+		Overrides:   overriddenOptions(r.EvalOptions, u.EvalOptions),
+		Result:      u,
+	})
+}
+
+// overriddenOptions returns the names of the exported evaluation options
+// whose values in o differ from the rule's own options ro. SortFunc cannot be
+// recorded, and is left out.
+func overriddenOptions(ro, o EvalOptions) []string {
+	rv, ov := reflect.ValueOf(ro), reflect.ValueOf(o)
+	var names []string
+	for i := 0; i < ov.NumField(); i++ {
+		f := ov.Type().Field(i)
+		if !f.IsExported() || f.Type.Kind() == reflect.Func {
+			continue
+		}
+		if rv.Field(i).Interface() != ov.Field(i).Interface() {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// recordedOptions returns an option that sets the named evaluation options
+// to their values in o, as if they had been passed to Eval.
+func recordedOptions(o EvalOptions, names []string) EvalOption {
+	return func(f *EvalOptions) {
+		src, dst := reflect.ValueOf(o), reflect.ValueOf(f).Elem()
+		for _, n := range names {
+			sf, ok := src.Type().FieldByName(n)
+			if !ok || !sf.IsExported() || sf.Type.Kind() == reflect.Func {
+				continue
+			}
+			dst.FieldByIndex(sf.Index).Set(src.FieldByIndex(sf.Index))
+			if n == "SortByPriority" {
+				f.overrideSort = true
+			}
+		}
+	}
+}
+
+// encodeValue encodes a value as JSON, using protojson for protocol buffers.
+// The result is compact.
+func encodeValue(v interface{}) (json.RawMessage, error) {
+	var b []byte
+	var err error
+	switch x := v.(type) {
+	case proto.Message:
+		b, err = protojson.Marshal(x)
+	default:
+		b, err = json.Marshal(x)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := bytes.Buffer{}
+	if err := json.Compact(&c, b); err != nil {
+		return nil, err
+	}
+	return c.Bytes(), nil
+}
+
+// ReplayResult is the outcome of re-evaluating a recorded decision.
+type ReplayResult struct {
+	// The recorded decision
+	Decision *Decision
+
+	// The result of the re-evaluation
+	Result *Result
+
+	// The rules whose outcome is different from the recorded decision.
+	// Empty if the re-evaluation produced the same outcome.
+	Changes []OutcomeChange
+}
+
+// Changed reports whether the outcome of the re-evaluation is different
+// from the recorded decision.
+func (r *ReplayResult) Changed() bool {
+	return len(r.Changes) > 0
+}
+
+// RuleOutcome is the pass/fail and value of a rule.
+type RuleOutcome struct {
+	Pass  bool
+	Value json.RawMessage
+}
+
+// OutcomeChange describes a rule whose outcome differs between the recorded
+// decision and the re-evaluation.
+type OutcomeChange struct {
+	// The location of the rule in the tree, as a list of rule IDs
+	// separated by a slash, starting with the root rule.
+	Path string
+
+	// The recorded and re-evaluated outcomes. Nil if the rule is missing
+	// from the results.
+	Old *RuleOutcome
+	New *RuleOutcome
+}
+
+type replayOptions struct {
+	store    RuleStore
+	data     func(d *Decision) (map[string]interface{}, error)
+	evalOpts []EvalOption
+}
+
+// ReplayOption is a functional option to specify how decisions are replayed.
+type ReplayOption func(o *replayOptions)
+
+// ReplayFromStore specifies that each decision is re-evaluated against the
+// version of the rule tree that made the decision, retrieved from the store.
+// The rule passed to Replay must be nil.
+func ReplayFromStore(s RuleStore) ReplayOption {
+	return func(o *replayOptions) {
+		o.store = s
+	}
+}
+
+// ReplayData specifies the function used to convert the recorded input data
+// to the data passed to the evaluator. The default decodes each data element
+// with encoding/json, and converts the values to the types of the elements
+// in the schemas of the rule and its descendants with Schema.Coerce, so that
+// numbers become int64 or float64, and objects become protocol buffer
+// messages or Go structs, as declared.
+func ReplayData(f func(d *Decision) (map[string]interface{}, error)) ReplayOption {
+	return func(o *replayOptions) {
+		o.data = f
+	}
+}
+
+// ReplayEvalOptions specifies the evaluation options passed to Eval when
+// re-evaluating the decisions. They are applied after the options recorded
+// with each decision, and override them.
+func ReplayEvalOptions(opts ...EvalOption) ReplayOption {
+	return func(o *replayOptions) {
+		o.evalOpts = opts
+	}
+}
+
+// Replay re-evaluates recorded decisions against the rule r, reporting which
+// outcomes changed. The rule must be compiled. If the ReplayFromStore option is
+// given, r must be nil, and each decision is re-evaluated against the version
+// of the rule tree that made it.
+//
+// Each decision is re-evaluated with the evaluation options that were passed
+// to Eval when it was made (see Decision.Overrides), and at the time it was
+// made, so that rules are in effect as they were then (see Clock). Use
+// ReplayEvalOptions to pass other options, such as a different Clock.
+func Replay(ctx context.Context, e Engine, r *Rule, decisions []*Decision, opts ...ReplayOption) ([]*ReplayResult, error) {
+	o := replayOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	switch {
+	case e == nil:
+		return nil, fmt.Errorf("engine is nil")
+	case r == nil && o.store == nil:
+		return nil, fmt.Errorf("rule is nil")
+	case r != nil && o.store != nil:
+		return nil, fmt.Errorf("a rule cannot be given when replaying from a store")
+	}
+
+	// rule trees retrieved from the store, by rule ID and version
+	compiled := map[[2]string]*Rule{}
+
+	results := make([]*ReplayResult, 0, len(decisions))
+	for i, dec := range decisions {
+		rule := r
+		if o.store != nil {
+			key := [2]string{dec.RuleID, dec.RuleVersion}
+			rule = compiled[key]
+			if rule == nil {
+				var err error
+				rule, err = o.store.Get(dec.RuleID, dec.RuleVersion)
+				if err != nil {
+					return nil, fmt.Errorf("decision %d: %w", i, err)
+				}
+				if err := e.Compile(rule); err != nil {
+					return nil, fmt.Errorf("decision %d: %w", i, err)
+				}
+				compiled[key] = rule
+			}
+		}
+
+		var data map[string]interface{}
+		var err error
+		if o.data != nil {
+			data, err = o.data(dec)
+		} else {
+			data, err = decodeDecisionData(dec, rule)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decision %d: decoding data: %w", i, err)
+		}
+
+		t := dec.Time
+		evalOpts := []EvalOption{
+			recordedOptions(dec.EvalOptions, dec.Overrides),
+			Clock(func() time.Time { return t }),
+		}
+		evalOpts = append(evalOpts, o.evalOpts...)
+
+		u, err := e.Eval(ctx, rule, data, evalOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("decision %d: %w", i, err)
+		}
+
+		changes, err := compareOutcomes(dec.Result, u)
+		if err != nil {
+			return nil, fmt.Errorf("decision %d: %w", i, err)
+		}
+
+		results = append(results, &ReplayResult{
+			Decision: dec,
+			Result:   u,
+			Changes:  changes,
+		})
+	}
+	return results, nil
+}
+
+// decodeDecisionData decodes the recorded data with encoding/json, and
+// coerces it to the schemas of the rule r and its descendants.
+func decodeDecisionData(d *Decision, r *Rule) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(d.Data))
+	for k, raw := range d.Data {
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("data element %s: %w", k, err)
+		}
+		data[k] = v
+	}
+
+	err := ApplyToRule(r, func(r *Rule) error {
+		s := r.EffectiveSchema()
+		var err error
+		data, err = s.Coerce(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// compareOutcomes lists the rules whose pass/fail or value is different
+// in the two result trees.
+func compareOutcomes(a, b *Result) ([]OutcomeChange, error) {
+	am, err := flattenOutcomes(a, "", map[string]*RuleOutcome{})
+	if err != nil {
+		return nil, err
+	}
+	bm, err := flattenOutcomes(b, "", map[string]*RuleOutcome{})
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(am)+len(bm))
+	for k := range am {
+		paths = append(paths, k)
+	}
+	for k := range bm {
+		if _, ok := am[k]; !ok {
+			paths = append(paths, k)
+		}
+	}
+	sort.Strings(paths)
+
+	changes := []OutcomeChange{}
+	for _, p := range paths {
+		o, n := am[p], bm[p]
+		if o != nil && n != nil && o.Pass == n.Pass && bytes.Equal(o.Value, n.Value) {
+			continue
+		}
+		changes = append(changes, OutcomeChange{Path: p, Old: o, New: n})
+	}
+	return changes, nil
+}
+
+// flattenOutcomes collects the outcome of each rule in the result tree, by path.
+func flattenOutcomes(u *Result, parent string, m map[string]*RuleOutcome) (map[string]*RuleOutcome, error) {
+	if u == nil {
+		return m, nil
+	}
+	path := joinPath(parent, u.Rule.ID)
+
+	value, err := canonicalValue(u.Value)
+	if err != nil {
+		return nil, fmt.Errorf("rule %s: %w", path, err)
+	}
+	m[path] = &RuleOutcome{Pass: u.Pass, Value: value}
+
+	for _, c := range u.Results {
+		if _, err := flattenOutcomes(c, path, m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// canonicalValue encodes the value as JSON with object keys in sorted order,
+// so that a value can be compared with the same value decoded from a
+// recorded decision.
+func canonicalValue(v interface{}) (json.RawMessage, error) {
+	b, err := encodeValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var x interface{}
+	if err := json.Unmarshal(b, &x); err != nil {
+		return nil, err
+	}
+	return json.Marshal(x)
+}
@@ -0,0 +1,287 @@
+package indigo_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/ezachrisen/indigo/testdata/school"
+	"github.com/matryer/is"
+)
+
+func makeOrderRule() *indigo.Rule {
+	schema := indigo.Schema{
+		ID: "order",
+		Elements: []indigo.DataElement{
+			{Name: "total", Type: indigo.Float{}},
+			{Name: "region", Type: indigo.String{}},
+		},
+	}
+
+	return &indigo.Rule{
+		ID:      "offers",
+		Version: "1",
+		Schema:  schema,
+		EvalOptions: indigo.EvalOptions{
+			TrueIfAny: true,
+		},
+		Rules: map[string]*indigo.Rule{
+			"ship_free": {
+				ID:     "ship_free",
+				Schema: schema,
+				Expr:   `total > 100.0`,
+			},
+			"discount": {
+				ID:         "discount",
+				Schema:     schema,
+				Expr:       `region == "west" ? 0.1 : 0.0`,
+				ResultType: indigo.Float{},
+			},
+		},
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	v1 := makeOrderRule()
+	is.NoErr(e.Compile(v1))
+
+	buf := bytes.Buffer{}
+	sink := indigo.NewJSONLinesSink(&buf)
+
+	inputs := []map[string]interface{}{
+		{"total": 150.0, "region": "west"},
+		{"total": 50.0, "region": "east"},
+	}
+
+	for _, d := range inputs {
+		_, err := e.Eval(context.Background(), v1, d, indigo.RecordDecisions(sink))
+		is.NoErr(err)
+	}
+
+	decisions, err := indigo.ReadDecisions(&buf)
+	is.NoErr(err)
+	is.Equal(len(decisions), 2)
+	is.Equal(decisions[0].RuleID, "offers")
+	is.Equal(decisions[0].RuleVersion, "1")
+	is.Equal(decisions[0].RuleHash, v1.Hash())
+	is.Equal(string(decisions[0].Data["region"]), `"west"`)
+	is.True(decisions[0].EvalOptions.TrueIfAny)
+	is.True(decisions[0].Result.Results["ship_free"].Pass)
+	is.Equal(decisions[0].Result.Results["discount"].Value, 0.1)
+
+	// Replaying against the same rules gives the same outcome
+	results, err := indigo.Replay(context.Background(), e, v1, decisions)
+	is.NoErr(err)
+	is.Equal(len(results), 2)
+	is.True(!results[0].Changed())
+	is.True(!results[1].Changed())
+
+	// Raise the free shipping threshold
+	v2 := makeOrderRule()
+	v2.Version = "2"
+	v2.Rules["ship_free"].Expr = `total > 200.0`
+	is.NoErr(e.Compile(v2))
+
+	results, err = indigo.Replay(context.Background(), e, v2, decisions)
+	is.NoErr(err)
+	is.True(results[0].Changed())
+	is.True(!results[1].Changed())
+	is.Equal(len(results[0].Changes), 1)
+	c := results[0].Changes[0]
+	is.Equal(c.Path, "offers/ship_free")
+	is.Equal(c.Old.Pass, true)
+	is.Equal(c.New.Pass, false)
+}
+
+func TestReplayFromStore(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	store := indigo.NewMemoryStore()
+
+	v1 := makeOrderRule()
+	is.NoErr(store.Put(v1))
+	is.NoErr(e.Compile(v1))
+
+	buf := bytes.Buffer{}
+	_, err := e.Eval(context.Background(), v1, map[string]interface{}{"total": 150.0, "region": "west"},
+		indigo.RecordDecisions(indigo.NewJSONLinesSink(&buf)))
+	is.NoErr(err)
+
+	decisions, err := indigo.ReadDecisions(&buf)
+	is.NoErr(err)
+
+	// v1 is replaced by v2 in production, but the decision is
+	// replayed against v1 from the store
+	v1.Rules["ship_free"].Expr = `total > 200.0`
+
+	results, err := indigo.Replay(context.Background(), e, nil, decisions, indigo.ReplayFromStore(store))
+	is.NoErr(err)
+	is.True(!results[0].Changed())
+
+	_, err = indigo.Replay(context.Background(), e, v1, decisions, indigo.ReplayFromStore(store))
+	is.True(err != nil)
+}
+
+func TestReplayData(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	r := &indigo.Rule{
+		ID:     "count",
+		Schema: indigo.Schema{Elements: []indigo.DataElement{{Name: "n", Type: indigo.Int{}}}},
+		Expr:   `n > 2`,
+	}
+	is.NoErr(e.Compile(r))
+
+	buf := bytes.Buffer{}
+	_, err := e.Eval(context.Background(), r, map[string]interface{}{"n": 3},
+		indigo.RecordDecisions(indigo.NewJSONLinesSink(&buf)))
+	is.NoErr(err)
+
+	decisions, err := indigo.ReadDecisions(&buf)
+	is.NoErr(err)
+
+	results, err := indigo.Replay(context.Background(), e, r, decisions)
+	is.NoErr(err)
+	is.True(!results[0].Changed())
+
+	// Replay with data different from what was recorded
+	data := func(d *indigo.Decision) (map[string]interface{}, error) {
+		return map[string]interface{}{"n": 1}, nil
+	}
+	results, err = indigo.Replay(context.Background(), e, r, decisions, indigo.ReplayData(data))
+	is.NoErr(err)
+	is.True(results[0].Changed())
+}
+
+func TestReplayEvalOptions(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	r := makeOrderRule()
+	is.NoErr(e.Compile(r))
+
+	// The options are passed to Eval, not set on the rule
+	buf := bytes.Buffer{}
+	_, err := e.Eval(context.Background(), r, map[string]interface{}{"total": 150.0, "region": "west"},
+		indigo.StopFirstPositiveChild(true), indigo.DiscardFail(indigo.Discard),
+		indigo.RecordDecisions(indigo.NewJSONLinesSink(&buf)))
+	is.NoErr(err)
+
+	decisions, err := indigo.ReadDecisions(&buf)
+	is.NoErr(err)
+	is.Equal(decisions[0].Overrides, []string{"StopFirstPositiveChild", "DiscardFail"})
+	is.Equal(len(decisions[0].Result.Results), 1)
+
+	results, err := indigo.Replay(context.Background(), e, r, decisions)
+	is.NoErr(err)
+	is.True(!results[0].Changed())
+	is.Equal(len(results[0].Result.Results), 1)
+
+	// The caller's options override the recorded ones
+	results, err = indigo.Replay(context.Background(), e, r, decisions,
+		indigo.ReplayEvalOptions(indigo.StopFirstPositiveChild(false)))
+	is.NoErr(err)
+	is.True(results[0].Changed())
+	is.Equal(len(results[0].Result.Results), 2)
+}
+
+func TestReplayCoercesData(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	r := &indigo.Rule{
+		ID: "honors",
+		Schema: indigo.Schema{Elements: []indigo.DataElement{
+			{Name: "credits", Type: indigo.Int{}},
+			{Name: "student", Type: indigo.Proto{Message: &school.Student{}}},
+			{Name: "tenure", Type: indigo.Duration{}},
+		}},
+		Expr: `credits % 2 == 1 && student.gpa > 3.0 && student.attrs["major"] == "math" && tenure > duration("1h")`,
+	}
+	is.NoErr(e.Compile(r))
+
+	d := map[string]interface{}{
+		"credits": int64(31),
+		"student": &school.Student{Gpa: 3.5, Attrs: map[string]string{"major": "math"}},
+		"tenure":  2 * time.Hour,
+	}
+
+	buf := bytes.Buffer{}
+	u, err := e.Eval(context.Background(), r, d, indigo.RecordDecisions(indigo.NewJSONLinesSink(&buf)))
+	is.NoErr(err)
+	is.True(u.Pass)
+
+	decisions, err := indigo.ReadDecisions(&buf)
+	is.NoErr(err)
+
+	results, err := indigo.Replay(context.Background(), e, r, decisions)
+	is.NoErr(err)
+	is.True(!results[0].Changed())
+	is.True(results[0].Result.Pass)
+}
+
+func TestReplayAtDecisionTime(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	r := makeOrderRule()
+
+	// The promotion ran until the end of 2022
+	r.Rules["discount"].EffectiveUntil = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	is.NoErr(e.Compile(r))
+
+	decided := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	buf := bytes.Buffer{}
+	_, err := e.Eval(context.Background(), r, map[string]interface{}{"total": 150.0, "region": "west"},
+		indigo.Clock(func() time.Time { return decided }),
+		indigo.RecordDecisions(indigo.NewJSONLinesSink(&buf)))
+	is.NoErr(err)
+
+	decisions, err := indigo.ReadDecisions(&buf)
+	is.NoErr(err)
+	is.True(decisions[0].Time.Equal(decided))
+	is.True(!decisions[0].Result.Results["discount"].Skipped)
+
+	// The decision is replayed when it was made, while the promotion ran
+	results, err := indigo.Replay(context.Background(), e, r, decisions)
+	is.NoErr(err)
+	is.True(!results[0].Changed())
+
+	// Replaying it today skips the promotion
+	results, err = indigo.Replay(context.Background(), e, r, decisions,
+		indigo.ReplayEvalOptions(indigo.Clock(time.Now)))
+	is.NoErr(err)
+	is.True(results[0].Result.Results["discount"].Skipped)
+}
+
+// failingSink fails to record decisions
+type failingSink struct{}
+
+func (failingSink) Record(*indigo.Decision) error {
+	return errors.New("disk full")
+}
+
+func TestRecordDecisionsError(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	r := makeOrderRule()
+	is.NoErr(e.Compile(r))
+
+	// the result is returned along with the error
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{"total": 150.0, "region": "west"},
+		indigo.RecordDecisions(failingSink{}))
+	is.Equal(err.Error(), "rule offers: recording decision: disk full")
+	is.True(u != nil)
+	is.True(u.Pass)
+	is.Equal(u.Results["discount"].Value, 0.1)
+}
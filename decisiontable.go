@@ -0,0 +1,791 @@
+package indigo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DecisionTable is a table of rules, in the style of DMN decision tables.
+// Each row of the table has a condition cell for each input column, and a
+// value for each output column. A row matches if all of its conditions are
+// met; the table's hit policy determines which matching rows produce the
+// output of the table.
+//
+// Use Rule to turn the table into a rule with one child rule per row, which
+// can be compiled and evaluated like any other rule. The conditions are
+// written as CEL expressions, so the rule must be evaluated with the CEL
+// evaluator.
+//
+// Condition cells use the following syntax, where the value is compared to
+// the input column's expression:
+//
+//	5               equal to 5
+//	!= 5            not equal to 5
+//	< 5, <= 5, > 5, >= 5
+//	[1..10]         between 1 and 10, inclusive; use ( or ] at the start,
+//	                and ) or [ at the end, to exclude the end point
+//	"a", "b", "c"   one of the values
+//
+// A cell containing a single dash ("-"), or a blank cell, matches any value.
+//
+// Values are written as CEL literals of the input column's type. String
+// values may be written without quotes, unless they contain a comma.
+type DecisionTable struct {
+	// The ID of the rule created from the table
+	ID string
+
+	// The schema of the data the table is evaluated against
+	Schema Schema
+
+	Inputs  []TableInput
+	Outputs []TableOutput
+	Rows    []TableRow
+
+	// The hit policy of the table. If not set, HitUnique is used.
+	HitPolicy HitPolicy
+
+	// The aggregation used by the HitCollect hit policy
+	Aggregation Aggregation
+}
+
+// TableInput is an input column of a decision table.
+type TableInput struct {
+	// A CEL expression for the input value, such as the name of a data
+	// element in the schema, or a field of a data element ("order.total").
+	Expr string
+
+	// The type of the input value. If nil, the type of the schema data
+	// element named Expr is used.
+	Type Type
+}
+
+// TableOutput is an output column of a decision table.
+type TableOutput struct {
+	Name string
+
+	// The type of the output values: Int, Float, Bool or String.
+	// If nil, the values are strings.
+	Type Type
+}
+
+// TableRow is a row of a decision table.
+type TableRow struct {
+	// The ID of the child rule created from the row. If blank, the row
+	// is identified by its position in the table: "row-1", "row-2" and so on.
+	ID string
+
+	// The priority of the row, used by the HitPriority hit policy
+	Priority int
+
+	// A condition for each input column
+	Conditions []string
+
+	// A value for each output column, parsed according to the column's type
+	Outputs []string
+}
+
+// Rule returns a rule with one child rule per row of the table, evaluated in
+// row order. Each child rule's expression combines the row's conditions, and
+// its Output is the row's output value: the value of the single output column,
+// or a map[string]interface{} of values by column name if the table has more
+// than one output column. The hit policy of the table is set on the rule.
+func (t *DecisionTable) Rule() (*Rule, error) {
+	inputs, err := t.inputTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	hp := t.HitPolicy
+	if hp == HitPolicyNone {
+		hp = HitUnique
+	}
+
+	r := &Rule{
+		ID:     t.ID,
+		Schema: t.Schema,
+		EvalOptions: EvalOptions{
+			HitPolicy:   hp,
+			Aggregation: t.Aggregation,
+		},
+	}
+
+	for i, row := range t.Rows {
+		id := t.rowID(i)
+		expr, err := t.rowExpr(row, inputs)
+		if err != nil {
+			return nil, fmt.Errorf("decision table %s: row %s: %w", t.ID, id, err)
+		}
+		out, err := t.rowOutput(row)
+		if err != nil {
+			return nil, fmt.Errorf("decision table %s: row %s: %w", t.ID, id, err)
+		}
+
+		c := &Rule{
+			ID:         id,
+			Schema:     t.Schema,
+			Expr:       expr,
+			ResultType: Bool{},
+			Output:     out,
+			Priority:   row.Priority,
+		}
+		if err := r.AddChild(c); err != nil {
+			return nil, fmt.Errorf("decision table %s: %w", t.ID, err)
+		}
+	}
+	return r, nil
+}
+
+// rowID returns the ID of the row at position i.
+func (t *DecisionTable) rowID(i int) string {
+	if t.Rows[i].ID != "" {
+		return t.Rows[i].ID
+	}
+	return fmt.Sprintf("row-%d", i+1)
+}
+
+// inputTypes returns the type of each input column, looking up types that
+// are not set in the schema.
+func (t *DecisionTable) inputTypes() ([]Type, error) {
+	types := make([]Type, len(t.Inputs))
+	for i, in := range t.Inputs {
+		if in.Expr == "" {
+			return nil, fmt.Errorf("decision table %s: input %d: missing expression", t.ID, i+1)
+		}
+		types[i] = in.Type
+		if types[i] != nil {
+			continue
+		}
+		for _, e := range t.Schema.Elements {
+			if e.Name == in.Expr {
+				types[i] = e.Type
+			}
+		}
+		if types[i] == nil {
+			return nil, fmt.Errorf("decision table %s: input %s: no type given and no data element %s in the schema", t.ID, in.Expr, in.Expr)
+		}
+	}
+	return types, nil
+}
+
+// rowExpr combines the row's conditions into a CEL expression.
+func (t *DecisionTable) rowExpr(row TableRow, types []Type) (string, error) {
+	if len(row.Conditions) != len(t.Inputs) {
+		return "", fmt.Errorf("%d conditions for %d inputs", len(row.Conditions), len(t.Inputs))
+	}
+
+	terms := []string{}
+	for i, s := range row.Conditions {
+		c, err := parseCell(s, types[i])
+		if err != nil {
+			return "", fmt.Errorf("input %s: %w", t.Inputs[i].Expr, err)
+		}
+		if x := c.expr(t.Inputs[i].Expr); x != "" {
+			terms = append(terms, x)
+		}
+	}
+	return strings.Join(terms, " && "), nil
+}
+
+// rowOutput returns the typed output value of the row.
+func (t *DecisionTable) rowOutput(row TableRow) (interface{}, error) {
+	if len(row.Outputs) != len(t.Outputs) {
+		return nil, fmt.Errorf("%d outputs for %d output columns", len(row.Outputs), len(t.Outputs))
+	}
+
+	values := make(map[string]interface{}, len(t.Outputs))
+	for i, o := range t.Outputs {
+		v, err := parseOutput(row.Outputs[i], o.Type)
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", o.Name, err)
+		}
+		if len(t.Outputs) == 1 {
+			return v, nil
+		}
+		values[o.Name] = v
+	}
+
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values, nil
+}
+
+// parseOutput converts an output cell to a value of the type.
+func parseOutput(s string, typ Type) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	switch typ.(type) {
+	case Int:
+		return strconv.ParseInt(s, 10, 64)
+	case Float:
+		return strconv.ParseFloat(s, 64)
+	case Bool:
+		return strconv.ParseBool(s)
+	case String, nil:
+		return unquote(s)
+	default:
+		return nil, fmt.Errorf("unsupported output type %v", typ)
+	}
+}
+
+// unquote removes double or single quotes around a string value, if present.
+func unquote(s string) (string, error) {
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '\'' && s[len(s)-1] == '\'') {
+		if s[0] == '\'' {
+			s = `"` + strings.ReplaceAll(s[1:len(s)-1], `"`, `\"`) + `"`
+		}
+		return strconv.Unquote(s)
+	}
+	return s, nil
+}
+
+// cellKind identifies the form of a condition cell.
+type cellKind int
+
+const (
+	cellAny cellKind = iota
+	cellCompare
+	cellRange
+	cellList
+)
+
+// literal is a value in a condition cell.
+type literal struct {
+	// the value as a CEL literal
+	cel string
+
+	// the value for static analysis: a float64 for numbers, a string for
+	// strings, a bool for bools; nil for types that cannot be analyzed
+	value interface{}
+}
+
+// cell is a parsed condition cell.
+type cell struct {
+	kind cellKind
+
+	// cellCompare: the CEL operator and operand
+	op  string
+	lit literal
+
+	// cellRange: the end points, and whether they are excluded
+	lo, hi         literal
+	loOpen, hiOpen bool
+
+	// cellList: the values
+	list []literal
+}
+
+// parseCell parses a condition cell for an input of the type.
+func parseCell(s string, typ Type) (cell, error) {
+	s = strings.TrimSpace(s)
+
+	if s == "" || s == "-" {
+		return cell{kind: cellAny}, nil
+	}
+
+	if (s[0] == '[' || s[0] == '(' || s[0] == ']') && strings.Contains(s, "..") {
+		return parseRange(s, typ)
+	}
+
+	for _, op := range []string{"<=", ">=", "!=", "==", "<", ">", "="} {
+		if strings.HasPrefix(s, op) {
+			l, err := parseLiteral(s[len(op):], typ)
+			if err != nil {
+				return cell{}, err
+			}
+			if op == "=" {
+				op = "=="
+			}
+			if op != "==" && op != "!=" {
+				switch typ.(type) {
+				case Int, Float, String, Duration, Timestamp:
+				default:
+					return cell{}, fmt.Errorf("operator %s not supported for type %v", op, typ)
+				}
+			}
+			return cell{kind: cellCompare, op: op, lit: l}, nil
+		}
+	}
+
+	parts := splitList(s)
+	if len(parts) > 1 {
+		c := cell{kind: cellList}
+		for _, p := range parts {
+			l, err := parseLiteral(p, typ)
+			if err != nil {
+				return cell{}, err
+			}
+			c.list = append(c.list, l)
+		}
+		return c, nil
+	}
+
+	l, err := parseLiteral(s, typ)
+	if err != nil {
+		return cell{}, err
+	}
+	return cell{kind: cellCompare, op: "==", lit: l}, nil
+}
+
+// parseRange parses a range such as [1..10).
+func parseRange(s string, typ Type) (cell, error) {
+	switch typ.(type) {
+	case Int, Float:
+	default:
+		return cell{}, fmt.Errorf("range %s not supported for type %v", s, typ)
+	}
+
+	end := s[len(s)-1]
+	if end != ']' && end != ')' && end != '[' {
+		return cell{}, fmt.Errorf("invalid range %s", s)
+	}
+
+	ends := strings.SplitN(s[1:len(s)-1], "..", 2)
+	lo, err := parseLiteral(ends[0], typ)
+	if err != nil {
+		return cell{}, err
+	}
+	hi, err := parseLiteral(ends[1], typ)
+	if err != nil {
+		return cell{}, err
+	}
+
+	return cell{
+		kind:   cellRange,
+		lo:     lo,
+		hi:     hi,
+		loOpen: s[0] != '[',
+		hiOpen: end != ']',
+	}, nil
+}
+
+// splitList splits a comma-separated list of values, ignoring commas
+// inside quotes.
+func splitList(s string) []string {
+	parts := []string{}
+	var quote rune
+	start := 0
+	for i, ch := range s {
+		switch {
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote == 0 && (ch == '"' || ch == '\''):
+			quote = ch
+		case quote == 0 && ch == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseLiteral converts a value in a condition cell to a CEL literal of the type.
+func parseLiteral(s string, typ Type) (literal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return literal{}, fmt.Errorf("missing value")
+	}
+
+	switch typ.(type) {
+	case Int:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return literal{}, fmt.Errorf("invalid int %s", s)
+		}
+		return literal{cel: strconv.FormatInt(i, 10), value: float64(i)}, nil
+	case Float:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return literal{}, fmt.Errorf("invalid float %s", s)
+		}
+		c := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(c, ".eEn") {
+			c += ".0"
+		}
+		return literal{cel: c, value: f}, nil
+	case String:
+		v, err := unquote(s)
+		if err != nil {
+			return literal{}, fmt.Errorf("invalid string %s", s)
+		}
+		return literal{cel: strconv.Quote(v), value: v}, nil
+	case Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return literal{}, fmt.Errorf("invalid bool %s", s)
+		}
+		return literal{cel: strconv.FormatBool(b), value: b}, nil
+	default:
+		return literal{cel: s}, nil
+	}
+}
+
+// expr returns the CEL expression for the condition, applied to the input
+// expression x. Returns a blank string if any value matches.
+func (c cell) expr(x string) string {
+	switch c.kind {
+	case cellCompare:
+		return fmt.Sprintf("%s %s %s", x, c.op, c.lit.cel)
+	case cellRange:
+		lo, hi := ">=", "<="
+		if c.loOpen {
+			lo = ">"
+		}
+		if c.hiOpen {
+			hi = "<"
+		}
+		return fmt.Sprintf("%s %s %s && %s %s %s", x, lo, c.lo.cel, x, hi, c.hi.cel)
+	case cellList:
+		l := make([]string, len(c.list))
+		for i := range c.list {
+			l[i] = c.list[i].cel
+		}
+		return fmt.Sprintf("%s in [%s]", x, strings.Join(l, ", "))
+	default:
+		return ""
+	}
+}
+
+// TableIssueKind identifies a problem found by DecisionTable.Validate.
+type TableIssueKind int
+
+const (
+	// TableOverlap means that more than one row matches the same input values,
+	// which is an error for the HitUnique hit policy, and for the HitAny hit
+	// policy if the rows have different outputs.
+	TableOverlap TableIssueKind = iota
+
+	// TableGap means that no row matches some input values.
+	TableGap
+)
+
+// String returns a human-readable name of the issue kind.
+func (k TableIssueKind) String() string {
+	switch k {
+	case TableOverlap:
+		return "overlap"
+	case TableGap:
+		return "gap"
+	default:
+		return fmt.Sprintf("TableIssueKind(%d)", int(k))
+	}
+}
+
+// TableIssue describes overlapping rows or a gap in a decision table.
+type TableIssue struct {
+	Kind TableIssueKind
+
+	// The IDs of the overlapping rows; empty for gaps
+	Rows []string
+
+	// A description of input values where the rows overlap, or that no row
+	// matches, one per input column
+	Inputs []string
+}
+
+// String returns a description of the issue.
+func (i TableIssue) String() string {
+	switch i.Kind {
+	case TableOverlap:
+		return fmt.Sprintf("rows %s overlap for %s", strings.Join(i.Rows, ", "), strings.Join(i.Inputs, ", "))
+	default:
+		return fmt.Sprintf("no row matches %s", strings.Join(i.Inputs, ", "))
+	}
+}
+
+// maxTableCells is the largest number of combinations of input values
+// Validate will check.
+const maxTableCells = 100000
+
+// Validate checks the table for overlapping rows and for gaps: input values
+// that no row matches. Overlaps are only reported for the HitUnique hit policy
+// (the default), and for the HitAny hit policy if the outputs of the rows are
+// different; other hit policies expect rows to overlap.
+//
+// Validate analyzes conditions on Int, Float, String and Bool inputs. It returns
+// an error if the table is malformed, or if it has conditions that cannot be
+// analyzed, such as an ordering comparison of strings or a condition on an
+// input of another type.
+func (t *DecisionTable) Validate() ([]TableIssue, error) {
+	types, err := t.inputTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	// the parsed conditions, by row and input
+	cells := make([][]cell, len(t.Rows))
+	outputs := make([]interface{}, len(t.Rows))
+	for i, row := range t.Rows {
+		if len(row.Conditions) != len(t.Inputs) {
+			return nil, fmt.Errorf("decision table %s: row %s: %d conditions for %d inputs", t.ID, t.rowID(i), len(row.Conditions), len(t.Inputs))
+		}
+		cells[i] = make([]cell, len(t.Inputs))
+		for j, s := range row.Conditions {
+			c, err := parseCell(s, types[j])
+			if err != nil {
+				return nil, fmt.Errorf("decision table %s: row %s: input %s: %w", t.ID, t.rowID(i), t.Inputs[j].Expr, err)
+			}
+			cells[i][j] = c
+		}
+		if outputs[i], err = t.rowOutput(row); err != nil {
+			return nil, fmt.Errorf("decision table %s: row %s: %w", t.ID, t.rowID(i), err)
+		}
+	}
+
+	// split each input's values into pieces that every condition either
+	// matches entirely or not at all
+	pieces := make([][]piece, len(t.Inputs))
+	total := 1
+	for j := range t.Inputs {
+		col := make([]cell, len(t.Rows))
+		for i := range t.Rows {
+			col[i] = cells[i][j]
+		}
+		p, err := inputPieces(types[j], col)
+		if err != nil {
+			return nil, fmt.Errorf("decision table %s: input %s: %w", t.ID, t.Inputs[j].Expr, err)
+		}
+		pieces[j] = p
+		total *= len(p)
+		if total > maxTableCells {
+			return nil, fmt.Errorf("decision table %s: too many combinations of input values to analyze", t.ID)
+		}
+	}
+
+	hp := t.HitPolicy
+	if hp == HitPolicyNone {
+		hp = HitUnique
+	}
+
+	issues := []TableIssue{}
+	overlaps := map[[2]int]bool{}
+
+	// check each combination of pieces
+	idx := make([]int, len(t.Inputs))
+	for n := 0; n < total; n++ {
+		matched := []int{}
+		for i := range t.Rows {
+			ok := true
+			for j := range t.Inputs {
+				if !pieces[j][idx[j]].matches(cells[i][j]) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				matched = append(matched, i)
+			}
+		}
+
+		if len(matched) == 0 {
+			issues = append(issues, TableIssue{Kind: TableGap, Inputs: t.describe(pieces, idx)})
+		}
+
+		for a := 0; a < len(matched); a++ {
+			for b := a + 1; b < len(matched); b++ {
+				ra, rb := matched[a], matched[b]
+				report := hp == HitUnique || (hp == HitAny && !valuesEqual(outputs[ra], outputs[rb]))
+				if !report || overlaps[[2]int{ra, rb}] {
+					continue
+				}
+				overlaps[[2]int{ra, rb}] = true
+				issues = append(issues, TableIssue{
+					Kind:   TableOverlap,
+					Rows:   []string{t.rowID(ra), t.rowID(rb)},
+					Inputs: t.describe(pieces, idx),
+				})
+			}
+		}
+
+		// advance to the next combination
+		for j := len(idx) - 1; j >= 0; j-- {
+			idx[j]++
+			if idx[j] < len(pieces[j]) {
+				break
+			}
+			idx[j] = 0
+		}
+	}
+
+	return issues, nil
+}
+
+// describe returns a description of each input's piece in the combination.
+func (t *DecisionTable) describe(pieces [][]piece, idx []int) []string {
+	l := make([]string, len(idx))
+	for j := range idx {
+		l[j] = t.Inputs[j].Expr + " " + pieces[j][idx[j]].desc
+	}
+	return l
+}
+
+// piece is a set of input values that every condition on the input either
+// matches entirely or not at all.
+type piece struct {
+	// a value in the piece, used to test whether a condition matches it
+	num  float64
+	str  string
+	b    bool
+	kind pieceKind
+
+	desc string
+}
+
+type pieceKind int
+
+const (
+	pieceNumber pieceKind = iota
+	pieceString
+	pieceOtherString
+	pieceBool
+)
+
+// matches reports whether the condition matches the values in the piece.
+func (p piece) matches(c cell) bool {
+	switch c.kind {
+	case cellAny:
+		return true
+	case cellCompare:
+		return p.compare(c.op, c.lit)
+	case cellRange:
+		lo, hi := ">=", "<="
+		if c.loOpen {
+			lo = ">"
+		}
+		if c.hiOpen {
+			hi = "<"
+		}
+		return p.compare(lo, c.lo) && p.compare(hi, c.hi)
+	case cellList:
+		for _, l := range c.list {
+			if p.compare("==", l) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compare applies the operator to the piece's value and the literal.
+func (p piece) compare(op string, l literal) bool {
+	switch p.kind {
+	case pieceNumber:
+		v := l.value.(float64)
+		switch op {
+		case "==":
+			return p.num == v
+		case "!=":
+			return p.num != v
+		case "<":
+			return p.num < v
+		case "<=":
+			return p.num <= v
+		case ">":
+			return p.num > v
+		case ">=":
+			return p.num >= v
+		}
+	case pieceString:
+		return (l.value.(string) == p.str) == (op == "==")
+	case pieceOtherString:
+		// the piece holds values not mentioned in any condition
+		return op == "!="
+	case pieceBool:
+		return (l.value.(bool) == p.b) == (op == "==")
+	}
+	return false
+}
+
+// inputPieces splits the values of an input into pieces, based on the values
+// mentioned in the conditions on the input.
+func inputPieces(typ Type, col []cell) ([]piece, error) {
+	analyzable := true
+	lits := []literal{}
+	for _, c := range col {
+		switch c.kind {
+		case cellCompare:
+			lits = append(lits, c.lit)
+			if _, ok := typ.(String); ok && c.op != "==" && c.op != "!=" {
+				analyzable = false
+			}
+		case cellRange:
+			lits = append(lits, c.lo, c.hi)
+		case cellList:
+			lits = append(lits, c.list...)
+		}
+	}
+
+	if len(lits) == 0 {
+		return []piece{{kind: pieceOtherString, desc: "any"}}, nil
+	}
+
+	switch typ.(type) {
+	case Int, Float:
+	case String:
+		if !analyzable {
+			return nil, fmt.Errorf("cannot analyze ordering comparisons of strings")
+		}
+	case Bool:
+		return []piece{
+			{kind: pieceBool, b: true, desc: "= true"},
+			{kind: pieceBool, b: false, desc: "= false"},
+		}, nil
+	default:
+		return nil, fmt.Errorf("cannot analyze conditions on type %v", typ)
+	}
+
+	if _, ok := typ.(String); ok {
+		seen := map[string]bool{}
+		values := []string{}
+		for _, l := range lits {
+			if s := l.value.(string); !seen[s] {
+				seen[s] = true
+				values = append(values, s)
+			}
+		}
+		sort.Strings(values)
+		pieces := make([]piece, 0, len(values)+1)
+		for _, v := range values {
+			pieces = append(pieces, piece{kind: pieceString, str: v, desc: "= " + strconv.Quote(v)})
+		}
+		return append(pieces, piece{kind: pieceOtherString, desc: "other"}), nil
+	}
+
+	_, isInt := typ.(Int)
+	points := []float64{}
+	seen := map[float64]bool{}
+	for _, l := range lits {
+		if f := l.value.(float64); !seen[f] {
+			seen[f] = true
+			points = append(points, f)
+		}
+	}
+	sort.Float64s(points)
+
+	format := func(f float64) string {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	pieces := []piece{{kind: pieceNumber, num: points[0] - 1, desc: "< " + format(points[0])}}
+	for i, p := range points {
+		pieces = append(pieces, piece{kind: pieceNumber, num: p, desc: "= " + format(p)})
+
+		if i == len(points)-1 {
+			break
+		}
+		next := points[i+1]
+		// an interval between two consecutive integers holds no ints
+		if isInt && math.Floor(p)+1 >= next {
+			continue
+		}
+		mid := p + (next-p)/2
+		if isInt {
+			mid = math.Floor(p) + 1
+		}
+		pieces = append(pieces, piece{kind: pieceNumber, num: mid, desc: fmt.Sprintf("(%s..%s)", format(p), format(next))})
+	}
+	last := points[len(points)-1]
+	return append(pieces, piece{kind: pieceNumber, num: last + 1, desc: "> " + format(last)}), nil
+}
@@ -0,0 +1,143 @@
+package indigo
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadDecisionTableCSV reads the columns and rows of a decision table from CSV.
+// The first record is a header that identifies each column:
+//
+//	in:<expr>          an input column for the CEL expression expr; the type
+//	                   is the type of the schema data element named expr
+//	in:<expr>:<type>   an input column of the type, such as int or float;
+//	                   the text after the last colon is only the type if
+//	                   ParseType accepts it, so expressions may contain
+//	                   colons, as in a ? b : c
+//	out:<name>         an output column of string values
+//	out:<name>:<type>  an output column of values of the type
+//	#id                the row IDs (optional)
+//	#priority          the row priorities (optional)
+//
+// Types are written as accepted by ParseType. For example:
+//
+//	#id,in:total,in:region,out:discount:float
+//	small,< 100,-,0
+//	west,>= 100,west,0.1
+//	other,>= 100,"!= ""west""",0.05
+//
+// The ID, schema and hit policy of the returned table must be set by the caller.
+func ReadDecisionTableCSV(r io.Reader) (*DecisionTable, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	t := &DecisionTable{}
+
+	// the position of each column in the inputs or outputs
+	const (
+		colInput = iota
+		colOutput
+		colID
+		colPriority
+	)
+	type column struct {
+		kind int
+		pos  int
+	}
+	cols := make([]column, len(header))
+
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		switch {
+		case h == "#id":
+			cols[i] = column{kind: colID}
+		case h == "#priority":
+			cols[i] = column{kind: colPriority}
+		case strings.HasPrefix(h, "in:"):
+			name, typ, err := parseColumnHeader(h[len("in:"):], true)
+			if err != nil {
+				return nil, fmt.Errorf("column %d: %w", i+1, err)
+			}
+			cols[i] = column{kind: colInput, pos: len(t.Inputs)}
+			t.Inputs = append(t.Inputs, TableInput{Expr: name, Type: typ})
+		case strings.HasPrefix(h, "out:"):
+			name, typ, err := parseColumnHeader(h[len("out:"):], false)
+			if err != nil {
+				return nil, fmt.Errorf("column %d: %w", i+1, err)
+			}
+			cols[i] = column{kind: colOutput, pos: len(t.Outputs)}
+			t.Outputs = append(t.Outputs, TableOutput{Name: name, Type: typ})
+		default:
+			return nil, fmt.Errorf("column %d: invalid header %q; must be #id, #priority, in:<expr> or out:<name>", i+1, h)
+		}
+	}
+
+	line := 1
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, err
+		}
+
+		row := TableRow{
+			Conditions: make([]string, len(t.Inputs)),
+			Outputs:    make([]string, len(t.Outputs)),
+		}
+		for i, v := range rec {
+			switch cols[i].kind {
+			case colID:
+				row.ID = strings.TrimSpace(v)
+			case colPriority:
+				if v = strings.TrimSpace(v); v != "" {
+					p, err := strconv.Atoi(v)
+					if err != nil {
+						return nil, fmt.Errorf("line %d: invalid priority %s", line, v)
+					}
+					row.Priority = p
+				}
+			case colInput:
+				row.Conditions[cols[i].pos] = v
+			case colOutput:
+				row.Outputs[cols[i].pos] = v
+			}
+		}
+		t.Rows = append(t.Rows, row)
+	}
+
+	return t, nil
+}
+
+// parseColumnHeader splits a column header into a name and an optional type,
+// separated by the last colon. If the header is an expression, which may
+// contain colons, the text after the last colon is part of the expression
+// unless it is a type.
+func parseColumnHeader(h string, expr bool) (string, Type, error) {
+	var typ Type
+	if i := strings.LastIndex(h, ":"); i >= 0 {
+		t, err := ParseType(strings.TrimSpace(h[i+1:]))
+		switch {
+		case err == nil:
+			typ = t
+			h = h[:i]
+		case !expr:
+			return "", nil, err
+		}
+	}
+	name := strings.TrimSpace(h)
+	if name == "" {
+		return "", nil, fmt.Errorf("missing name")
+	}
+	return name, typ, nil
+}
@@ -0,0 +1,180 @@
+package indigo_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/matryer/is"
+)
+
+const discountCSV = `#id,in:total,in:region,out:discount:float
+small,< 100,-,0
+west,>= 100,west,0.1
+other,>= 100,"!= ""west""",0.05
+`
+
+func makeDiscountTable(t *testing.T) *indigo.DecisionTable {
+	dt, err := indigo.ReadDecisionTableCSV(strings.NewReader(discountCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dt.ID = "discount"
+	dt.Schema = indigo.Schema{
+		Elements: []indigo.DataElement{
+			{Name: "total", Type: indigo.Float{}},
+			{Name: "region", Type: indigo.String{}},
+		},
+	}
+	return dt
+}
+
+func TestDecisionTable(t *testing.T) {
+	is := is.New(t)
+
+	dt := makeDiscountTable(t)
+	is.Equal(len(dt.Inputs), 2)
+	is.Equal(dt.Outputs[0], indigo.TableOutput{Name: "discount", Type: indigo.Float{}})
+	is.Equal(len(dt.Rows), 3)
+
+	r, err := dt.Rule()
+	is.NoErr(err)
+	is.Equal(r.EvalOptions.HitPolicy, indigo.HitUnique)
+	is.Equal(childIDs(r.Children()), []string{"small", "west", "other"})
+	is.Equal(r.Rules["small"].Expr, `total < 100.0`)
+	is.Equal(r.Rules["west"].Expr, `total >= 100.0 && region == "west"`)
+	is.Equal(r.Rules["other"].Expr, `total >= 100.0 && region != "west"`)
+	is.Equal(r.Rules["west"].Output, 0.1)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(r))
+
+	cases := []struct {
+		total  float64
+		region string
+		want   float64
+	}{
+		{50, "west", 0},
+		{150, "west", 0.1},
+		{150, "east", 0.05},
+	}
+	for _, c := range cases {
+		u, err := e.Eval(context.Background(), r, map[string]interface{}{"total": c.total, "region": c.region})
+		is.NoErr(err)
+		is.True(u.Pass)
+		is.Equal(u.Value, c.want)
+	}
+
+	issues, err := dt.Validate()
+	is.NoErr(err)
+	is.Equal(len(issues), 0)
+}
+
+// Input expressions may contain colons; the text after the last colon is
+// only a type if it parses as one
+func TestDecisionTableCSVColumnHeaders(t *testing.T) {
+	is := is.New(t)
+
+	cases := []struct {
+		header string
+		want   indigo.TableInput
+	}{
+		{"in:total", indigo.TableInput{Expr: "total"}},
+		{"in:total:float", indigo.TableInput{Expr: "total", Type: indigo.Float{}}},
+		{"in:vip ? total : 0.0", indigo.TableInput{Expr: "vip ? total : 0.0"}},
+		{"in:vip ? total : 0.0:float", indigo.TableInput{Expr: "vip ? total : 0.0", Type: indigo.Float{}}},
+		{`in:attrs["a:b"]`, indigo.TableInput{Expr: `attrs["a:b"]`}},
+		{`in:attrs["a:b"]:string`, indigo.TableInput{Expr: `attrs["a:b"]`, Type: indigo.String{}}},
+	}
+
+	for _, c := range cases {
+		quoted := `"` + strings.ReplaceAll(c.header, `"`, `""`) + `"`
+		dt, err := indigo.ReadDecisionTableCSV(strings.NewReader(quoted + ",out:x\n"))
+		is.NoErr(err)
+		is.Equal(dt.Inputs, []indigo.TableInput{c.want})
+	}
+
+	// output names cannot contain colons
+	_, err := indigo.ReadDecisionTableCSV(strings.NewReader("in:total,out:discount:flaot\n"))
+	is.True(err != nil)
+}
+
+func TestDecisionTableCells(t *testing.T) {
+	is := is.New(t)
+
+	dt := &indigo.DecisionTable{
+		ID: "grade",
+		Inputs: []indigo.TableInput{
+			{Expr: "score", Type: indigo.Int{}},
+			{Expr: "member", Type: indigo.Bool{}},
+			{Expr: "tier", Type: indigo.String{}},
+		},
+		Outputs: []indigo.TableOutput{
+			{Name: "grade"},
+			{Name: "points", Type: indigo.Int{}},
+		},
+		HitPolicy: indigo.HitCollect,
+		Rows: []indigo.TableRow{
+			{Conditions: []string{"[90..100]", "true", `gold, "silver, plus"`}, Outputs: []string{"A", "10"}},
+			{Conditions: []string{"(50..90)", "-", "-"}, Outputs: []string{`"B"`, "5"}},
+		},
+	}
+
+	r, err := dt.Rule()
+	is.NoErr(err)
+	is.Equal(r.Rules["row-1"].Expr, `score >= 90 && score <= 100 && member == true && tier in ["gold", "silver, plus"]`)
+	is.Equal(r.Rules["row-2"].Expr, `score > 50 && score < 90`)
+	is.Equal(r.Rules["row-1"].Output, map[string]interface{}{"grade": "A", "points": int64(10)})
+
+	dt.Rows[0].Conditions[0] = "[a..b]"
+	_, err = dt.Rule()
+	is.True(err != nil)
+
+	dt.Rows[0].Conditions = []string{"1"}
+	_, err = dt.Rule()
+	is.True(err != nil) // wrong number of conditions
+}
+
+func TestDecisionTableValidate(t *testing.T) {
+	is := is.New(t)
+
+	dt := &indigo.DecisionTable{
+		ID: "fee",
+		Inputs: []indigo.TableInput{
+			{Expr: "amount", Type: indigo.Int{}},
+			{Expr: "region", Type: indigo.String{}},
+		},
+		Outputs: []indigo.TableOutput{{Name: "fee", Type: indigo.Int{}}},
+		Rows: []indigo.TableRow{
+			{ID: "low", Conditions: []string{"< 10", "-"}, Outputs: []string{"0"}},
+			{ID: "mid", Conditions: []string{"[10..100]", "west"}, Outputs: []string{"1"}},
+			{ID: "high", Conditions: []string{">= 100", "-"}, Outputs: []string{"2"}},
+		},
+	}
+
+	issues, err := dt.Validate()
+	is.NoErr(err)
+
+	got := []string{}
+	for _, i := range issues {
+		got = append(got, i.String())
+	}
+	is.Equal(got, []string{
+		`no row matches amount = 10, region other`,
+		`no row matches amount (10..100), region other`,
+		`rows mid, high overlap for amount = 100, region = "west"`,
+	})
+
+	// overlaps are expected with other hit policies
+	dt.HitPolicy = indigo.HitFirst
+	issues, err = dt.Validate()
+	is.NoErr(err)
+	is.Equal(len(issues), 2)
+
+	// ordering comparisons of strings cannot be analyzed
+	dt.Rows[1].Conditions[1] = "> m"
+	_, err = dt.Validate()
+	is.True(err != nil)
+}
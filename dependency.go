@@ -0,0 +1,202 @@
+package indigo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// resolveDependencies finds the rules each rule in the tree depends on,
+// checking that every dependency is a rule in the tree with a unique ID, and
+// that there are no cycles. A parent rule depends on its child rules, so a
+// rule cannot depend on one of its ancestors.
+// If dryRun is false, the resolved dependencies are stored in the rules.
+func resolveDependencies(root *Rule, dryRun bool) error {
+	all := []*Rule{}
+	byID := map[string][]*Rule{}
+	_ = ApplyToRule(root, func(r *Rule) error {
+		all = append(all, r)
+		byID[r.ID] = append(byID[r.ID], r)
+		return nil
+	})
+
+	deps := map[*Rule][]*Rule{}
+	for _, r := range all {
+		for _, id := range r.DependsOn {
+			targets := byID[id]
+			switch {
+			case len(targets) == 0:
+				return fmt.Errorf("rule %s: depends on unknown rule %s", r.ID, id)
+			case len(targets) > 1:
+				return fmt.Errorf("rule %s: depends on rule %s, but %d rules have that ID", r.ID, id, len(targets))
+			}
+			deps[r] = append(deps[r], targets[0])
+		}
+	}
+
+	if err := checkCycles(root, deps); err != nil {
+		return err
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	for _, r := range all {
+		r.deps = deps[r]
+		r.referenced = false
+	}
+
+	// mark the rules other rules depend on, so that their results are kept
+	// during evaluation
+	for _, l := range deps {
+		for _, dep := range l {
+			dep.referenced = true
+		}
+	}
+	return nil
+}
+
+// checkCycles returns an error if a rule depends on itself, directly or
+// through its child rules and dependencies.
+func checkCycles(root *Rule, deps map[*Rule][]*Rule) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[*Rule]int{}
+	path := []string{}
+
+	var visit func(r *Rule) error
+	visit = func(r *Rule) error {
+		switch state[r] {
+		case visiting:
+			start := 0
+			for i := range path {
+				if path[i] == r.ID {
+					start = i
+				}
+			}
+			return fmt.Errorf("rule %s: dependency cycle: %s -> %s", r.ID, strings.Join(path[start:], " -> "), r.ID)
+		case visited:
+			return nil
+		}
+
+		state[r] = visiting
+		path = append(path, r.ID)
+		for _, c := range r.orderedChildren() {
+			if err := visit(c); err != nil {
+				return err
+			}
+		}
+		for _, dep := range deps[r] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[r] = visited
+		return nil
+	}
+
+	return visit(root)
+}
+
+// ExpressionSchema returns the schema the rule's expression is compiled and
+// evaluated against, given the rule's effective schema s (see
+// ResolveSchema): s, with the RulesKey data element added if the rule
+// depends on other rules. It returns an error if s already has an element
+// named RulesKey.
+func (r *Rule) ExpressionSchema(s Schema) (Schema, error) {
+	if len(r.DependsOn) == 0 {
+		return s, nil
+	}
+
+	for _, e := range s.Elements {
+		if e.Name == RulesKey {
+			return Schema{}, fmt.Errorf("rule %s: the schema element name %s is reserved for the results of dependencies", r.ID, RulesKey)
+		}
+	}
+
+	s.Elements = append(append([]DataElement(nil), s.Elements...),
+		DataElement{
+			Name:        RulesKey,
+			Type:        Map{KeyType: String{}, ValueType: Map{KeyType: String{}, ValueType: Any{}}},
+			Description: "Results of the rules this rule depends on",
+		})
+	return s, nil
+}
+
+// evalState holds the state of a single call to Eval.
+type evalState struct {
+	// the results of rules that other rules depend on, so that each is
+	// only evaluated once
+	results map[*Rule]*Result
+
+	// the rules whose dependencies are being evaluated
+	active map[*Rule]bool
+
+	// the actions that fire, in the order the rules were evaluated
+	actions []ActionRun
+
+	// the time of the evaluation, read from the clock when first needed
+	now time.Time
+}
+
+// time returns the time of the evaluation, reading the clock in the
+// evaluation options the first time it is called.
+func (s *evalState) time(o EvalOptions) time.Time {
+	if s.now.IsZero() {
+		s.now = time.Now()
+		if o.clock != nil {
+			s.now = o.clock()
+		}
+	}
+	return s.now
+}
+
+// dependencyData returns a copy of the data, with the results of the rules
+// r depends on added under the rules key. The dependencies are evaluated
+// if they have not already been evaluated.
+func (e *DefaultEngine) dependencyData(ctx context.Context, r *Rule, d map[string]interface{},
+	s *evalState, opts ...EvalOption) (map[string]interface{}, error) {
+
+	if len(r.deps) != len(r.DependsOn) {
+		return nil, fmt.Errorf("rule %s: dependencies not resolved; the rule must be compiled", r.ID)
+	}
+
+	if s.active == nil {
+		s.active = map[*Rule]bool{}
+	}
+	if s.active[r] {
+		return nil, fmt.Errorf("rule %s: dependency cycle", r.ID)
+	}
+	s.active[r] = true
+	defer delete(s.active, r)
+
+	refs := make(map[string]interface{}, len(r.deps))
+	for _, dep := range r.deps {
+		u, err := e.eval(ctx, dep, d, s, opts...)
+		if err != nil {
+			return nil, err
+		}
+		refs[dep.ID] = map[string]interface{}{
+			"pass":            u.Pass,
+			"expression_pass": u.ExpressionPass,
+			"skipped":         u.Skipped,
+			"value":           u.Value,
+		}
+	}
+
+	data := make(map[string]interface{}, len(d)+1)
+	for k, v := range d {
+		data[k] = v
+	}
+	data[RulesKey] = refs
+
+	// evaluating the dependencies replaced the self object in d
+	setSelfKey(r, data)
+	return data, nil
+}
@@ -0,0 +1,142 @@
+package indigo_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/matryer/is"
+)
+
+// countingEvaluator counts the number of times each expression is evaluated.
+type countingEvaluator struct {
+	*cel.Evaluator
+	n map[string]int
+}
+
+func (c *countingEvaluator) Evaluate(data map[string]interface{}, expr string, s indigo.Schema, self interface{},
+	prg interface{}, resultType indigo.Type, returnDiagnostics bool) (interface{}, *indigo.Diagnostics, error) {
+	c.n[expr]++
+	return c.Evaluator.Evaluate(data, expr, s, self, prg, resultType, returnDiagnostics)
+}
+
+func makePricingRule() *indigo.Rule {
+	schema := indigo.Schema{
+		ID: "order",
+		Elements: []indigo.DataElement{
+			{Name: "total", Type: indigo.Float{}},
+			{Name: "tier", Type: indigo.String{}},
+		},
+	}
+
+	r := &indigo.Rule{ID: "pricing", Schema: schema}
+	for _, c := range []*indigo.Rule{
+		{
+			ID:         "due",
+			Schema:     schema,
+			Expr:       `rules.discount.pass ? total + rules.tax.value - 10.0 : total + rules.tax.value`,
+			ResultType: indigo.Float{},
+			DependsOn:  []string{"tax", "discount"},
+		},
+		{
+			ID:        "discount",
+			Schema:    schema,
+			Expr:      `rules.is_vip.pass && total > 100.0`,
+			DependsOn: []string{"is_vip"},
+		},
+		{ID: "is_vip", Schema: schema, Expr: `tier == "gold"`},
+		{ID: "tax", Schema: schema, Expr: `total * 0.1`, ResultType: indigo.Float{}},
+	} {
+		_ = r.AddChild(c)
+	}
+	return r
+}
+
+func TestDependencies(t *testing.T) {
+	is := is.New(t)
+
+	ev := &countingEvaluator{Evaluator: cel.NewEvaluator(), n: map[string]int{}}
+	e := indigo.NewEngine(ev)
+	r := makePricingRule()
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{"total": 200.0, "tier": "gold"})
+	is.NoErr(err)
+	is.Equal(u.Results["due"].Value, 210.0)
+	is.True(u.Results["discount"].Pass)
+	is.Equal(u.Results["tax"].Value, 20.0)
+
+	// each rule was evaluated once, even though due and discount were
+	// evaluated before the rules they depend on in child order
+	for expr, n := range ev.n {
+		if n != 1 {
+			t.Errorf("%s evaluated %d times", expr, n)
+		}
+	}
+	is.Equal(len(ev.n), 5)
+
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{"total": 200.0, "tier": "silver"})
+	is.NoErr(err)
+	is.Equal(u.Results["due"].Value, 220.0)
+	is.True(!u.Results["discount"].Pass)
+}
+
+func TestDependencyErrors(t *testing.T) {
+	is := is.New(t)
+	e := indigo.NewEngine(newMockEvaluator())
+
+	cases := map[string]struct {
+		prep func(r *indigo.Rule)
+		err  string
+	}{
+		"unknown": {
+			prep: func(r *indigo.Rule) { r.Rules["B"].Rules["b1"].DependsOn = []string{"x"} },
+			err:  "unknown rule x",
+		},
+		"duplicate": {
+			prep: func(r *indigo.Rule) {
+				r.Rules["D"].Rules["b1"] = &indigo.Rule{ID: "b1"}
+				r.Rules["E"].DependsOn = []string{"b1"}
+			},
+			err: "2 rules have that ID",
+		},
+		"self": {
+			prep: func(r *indigo.Rule) { r.Rules["B"].DependsOn = []string{"B"} },
+			err:  "dependency cycle: B -> B",
+		},
+		"ancestor": {
+			prep: func(r *indigo.Rule) { r.Rules["B"].Rules["b4"].Rules["b4-1"].DependsOn = []string{"B"} },
+			err:  "dependency cycle: B -> b4 -> b4-1 -> B",
+		},
+		"siblings": {
+			prep: func(r *indigo.Rule) {
+				r.Rules["D"].Rules["d1"].DependsOn = []string{"e1"}
+				r.Rules["E"].Rules["e1"].DependsOn = []string{"d1"}
+			},
+			err: "dependency cycle: d1 -> e1 -> d1",
+		},
+		"reserved": {
+			prep: func(r *indigo.Rule) {
+				r.Rules["B"].DependsOn = []string{"D"}
+				r.Rules["B"].Schema.Elements = []indigo.DataElement{{Name: "rules", Type: indigo.Int{}}}
+			},
+			err: "reserved",
+		},
+	}
+
+	for k, c := range cases {
+		r := makeRule()
+		c.prep(r)
+		err := e.Compile(r)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: got error %v, wanted %q", k, err, c.err)
+		}
+	}
+
+	// a rule may depend on its own descendants
+	r := makeRule()
+	r.Rules["B"].DependsOn = []string{"b4-2"}
+	is.NoErr(e.Compile(r))
+}
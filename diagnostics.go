@@ -27,19 +27,37 @@ const (
 	Evaluated
 )
 
+// MarshalText encodes the value source as its name.
+func (i ValueSource) MarshalText() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+// UnmarshalText decodes a value source from its name.
+func (i *ValueSource) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case Input.String():
+		*i = Input
+	case Evaluated.String():
+		*i = Evaluated
+	default:
+		return fmt.Errorf("unknown value source: %s", b)
+	}
+	return nil
+}
+
 // Diagnostics holds the internal rule-engine intermediate results.
 // Request diagnostics for an evaluation to help understand how the engine
 // reached the final output value.
 // Diagnostics is a nested set of nodes, with 1 root node per rule evaluated.
 // The children represent elements of the expression evaluated.
 type Diagnostics struct {
-	Expr      string // the part of the rule expression evaluated
-	Interface interface{}
-	Source    ValueSource   // where the value came from: input data, or evaluted by the engine
-	Line      int           // the 1-based line number in the original source expression
-	Column    int           // the 0-based column number in the original source expression
-	Offset    int           // the 0-based character offset from the start of the original source expression
-	Children  []Diagnostics // one child per sub-expression. Each Evaluator may produce different results.
+	Expr      string        `json:"expr"` // the part of the rule expression evaluated
+	Interface interface{}   `json:"value,omitempty"`
+	Source    ValueSource   `json:"source"`             // where the value came from: input data, or evaluted by the engine
+	Line      int           `json:"line"`               // the 1-based line number in the original source expression
+	Column    int           `json:"column"`             // the 0-based column number in the original source expression
+	Offset    int           `json:"offset"`             // the 0-based character offset from the start of the original source expression
+	Children  []Diagnostics `json:"children,omitempty"` // one child per sub-expression. Each Evaluator may produce different results.
 }
 
 // String produces an ASCII table with human-readable diagnostics.
@@ -134,11 +152,9 @@ func diagnosticsRecursive(u *Result, data map[string]interface{}) string {
 	}
 
 	s.WriteString("\n")
-	if u.Results != nil {
-		for k := range u.Results {
-			s.WriteString(diagnosticsRecursive(u.Results[k], nil))
-			s.WriteString("\n")
-		}
+	for _, c := range u.childResults() {
+		s.WriteString(diagnosticsRecursive(c, nil))
+		s.WriteString("\n")
 	}
 	return s.String()
 
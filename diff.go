@@ -0,0 +1,469 @@
+package indigo
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// ChangeKind identifies the type of difference between two rule trees.
+type ChangeKind int
+
+const (
+	// RuleAdded means that the rule exists only in the new rule tree.
+	RuleAdded ChangeKind = iota
+
+	// RuleRemoved means that the rule exists only in the old rule tree.
+	RuleRemoved
+
+	// ExprChanged means that the rule's expression is different.
+	ExprChanged
+
+	// EvalOptionsChanged means that one of the rule's evaluation options is different.
+	EvalOptionsChanged
+
+	// RuleMoved means that the rule has a different parent in the new rule tree.
+	// Rules are only considered moved if their ID is unique in both trees.
+	RuleMoved
+
+	// ResultTypeChanged means that the rule's result type is different.
+	ResultTypeChanged
+
+	// SchemaChanged means that the rule's schema ID, one of its data elements,
+	// or one of the rule's extra data elements is different.
+	SchemaChanged
+
+	// ChildOrderChanged means that the rule's child rules are in a different order.
+	// Only child rules present in both trees are compared.
+	ChildOrderChanged
+
+	// PriorityChanged means that the rule's priority is different.
+	PriorityChanged
+
+	// OutputChanged means that the rule's fixed output is different.
+	OutputChanged
+
+	// WeightChanged means that the rule's weight is different.
+	WeightChanged
+
+	// DependenciesChanged means that the rule depends on different rules.
+	DependenciesChanged
+
+	// ActionsChanged means that the rule's actions are different. The Field
+	// is "on_pass" or "on_fail".
+	ActionsChanged
+
+	// DisabledChanged means that the rule was disabled or enabled.
+	DisabledChanged
+
+	// EffectivePeriodChanged means that the start or end of the period during
+	// which the rule is in effect is different. The Field is "effective_from"
+	// or "effective_until".
+	EffectivePeriodChanged
+)
+
+// String returns a human-readable name of the change kind.
+func (k ChangeKind) String() string {
+	switch k {
+	case RuleAdded:
+		return "added"
+	case RuleRemoved:
+		return "removed"
+	case ExprChanged:
+		return "expression"
+	case EvalOptionsChanged:
+		return "eval options"
+	case RuleMoved:
+		return "moved"
+	case ResultTypeChanged:
+		return "result type"
+	case SchemaChanged:
+		return "schema"
+	case ChildOrderChanged:
+		return "child order"
+	case PriorityChanged:
+		return "priority"
+	case OutputChanged:
+		return "output"
+	case WeightChanged:
+		return "weight"
+	case DependenciesChanged:
+		return "dependencies"
+	case ActionsChanged:
+		return "actions"
+	case DisabledChanged:
+		return "disabled"
+	case EffectivePeriodChanged:
+		return "effective period"
+	default:
+		return fmt.Sprintf("ChangeKind(%d)", int(k))
+	}
+}
+
+// Change describes a single difference between two rule trees.
+type Change struct {
+	Kind ChangeKind
+
+	// The ID of the rule that changed
+	RuleID string
+
+	// The location of the rule in the tree, as a list of rule IDs
+	// separated by a slash, starting with the root rule.
+	Path string
+
+	// For changes to evaluation options, the JSON name of the option that changed.
+	// For schema changes, the name of the data element that changed, or "id"
+	// if the schema ID changed; the names of the rule's extra data elements
+	// are prefixed with "+". For changes to actions and the effective period,
+	// the JSON name of the field that changed.
+	Field string
+
+	// The old and new values, as text. Blank if not applicable.
+	Old string
+	New string
+}
+
+// Changes is a list of differences between two rule trees.
+type Changes []Change
+
+// Diff compares two rule trees and returns the list of changes needed to
+// turn rule a into rule b. Rules are matched by their location in the tree;
+// a rule whose ID is unique in both trees and that has a different parent in
+// rule b is reported as moved, followed by any changes to its content.
+// Changes are listed in tree order, with child rules sorted by ID.
+func Diff(a, b *Rule) Changes {
+	d := differ{
+		changes:   Changes{},
+		oldIDs:    countIDs(a, map[string]int{}),
+		newIDs:    countIDs(b, map[string]int{}),
+		oldByID:   map[string]*Rule{},
+		oldPathOf: map[string]string{},
+	}
+	indexRules(a, "", d.oldByID, d.oldPathOf)
+	d.diffRules(a, b, "")
+	return d.changes
+}
+
+// differ holds the state of a comparison between two rule trees.
+type differ struct {
+	changes Changes
+
+	// the number of times each rule ID appears in the old and new trees
+	oldIDs map[string]int
+	newIDs map[string]int
+
+	// the rules in the old tree, by ID, and their paths
+	oldByID   map[string]*Rule
+	oldPathOf map[string]string
+}
+
+// movable reports whether a rule with this ID can be tracked across the two trees.
+func (d *differ) movable(id string) bool {
+	return d.oldIDs[id] == 1 && d.newIDs[id] == 1
+}
+
+// diffRules compares two rules at the same location in the tree, and
+// recursively compares their children.
+func (d *differ) diffRules(a, b *Rule, parent string) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil:
+		if old, ok := d.oldByID[b.ID]; ok && d.movable(b.ID) {
+			path := joinPath(parent, b.ID)
+			d.add(Change{Kind: RuleMoved, RuleID: b.ID, Path: path, Old: d.oldPathOf[b.ID], New: path})
+			d.diffRules(old, b, parent)
+			return
+		}
+		path := joinPath(parent, b.ID)
+		d.add(Change{Kind: RuleAdded, RuleID: b.ID, Path: path, New: b.Expr})
+		d.movedInto(b, path)
+		return
+	case b == nil:
+		// Rules moved out of the old rule, or its descendants, are reported
+		// where they appear in the new tree
+		if d.movable(a.ID) {
+			return
+		}
+		d.add(Change{Kind: RuleRemoved, RuleID: a.ID, Path: joinPath(parent, a.ID), Old: a.Expr})
+		return
+	}
+
+	path := joinPath(parent, b.ID)
+
+	if a.Expr != b.Expr {
+		d.add(Change{Kind: ExprChanged, RuleID: b.ID, Path: path, Old: a.Expr, New: b.Expr})
+	}
+
+	if !reflect.DeepEqual(a.Output, b.Output) {
+		d.add(Change{Kind: OutputChanged, RuleID: b.ID, Path: path, Old: outputString(a.Output), New: outputString(b.Output)})
+	}
+
+	if a.Priority != b.Priority {
+		d.add(Change{Kind: PriorityChanged, RuleID: b.ID, Path: path, Old: strconv.Itoa(a.Priority), New: strconv.Itoa(b.Priority)})
+	}
+
+	if a.Weight != b.Weight {
+		d.add(Change{Kind: WeightChanged, RuleID: b.ID, Path: path, Old: strconv.FormatFloat(a.Weight, 'g', -1, 64), New: strconv.FormatFloat(b.Weight, 'g', -1, 64)})
+	}
+
+	if ad, bd := strings.Join(a.DependsOn, ","), strings.Join(b.DependsOn, ","); ad != bd {
+		d.add(Change{Kind: DependenciesChanged, RuleID: b.ID, Path: path, Old: ad, New: bd})
+	}
+
+	if ap, bp := strings.Join(a.OnPass, ","), strings.Join(b.OnPass, ","); ap != bp {
+		d.add(Change{Kind: ActionsChanged, RuleID: b.ID, Path: path, Field: "on_pass", Old: ap, New: bp})
+	}
+
+	if af, bf := strings.Join(a.OnFail, ","), strings.Join(b.OnFail, ","); af != bf {
+		d.add(Change{Kind: ActionsChanged, RuleID: b.ID, Path: path, Field: "on_fail", Old: af, New: bf})
+	}
+
+	if a.Disabled != b.Disabled {
+		d.add(Change{Kind: DisabledChanged, RuleID: b.ID, Path: path, Old: strconv.FormatBool(a.Disabled), New: strconv.FormatBool(b.Disabled)})
+	}
+
+	if af, bf := timeString(a.EffectiveFrom), timeString(b.EffectiveFrom); af != bf {
+		d.add(Change{Kind: EffectivePeriodChanged, RuleID: b.ID, Path: path, Field: "effective_from", Old: af, New: bf})
+	}
+
+	if au, bu := timeString(a.EffectiveUntil), timeString(b.EffectiveUntil); au != bu {
+		d.add(Change{Kind: EffectivePeriodChanged, RuleID: b.ID, Path: path, Field: "effective_until", Old: au, New: bu})
+	}
+
+	if at, bt := defaultResultType(a).String(), defaultResultType(b).String(); at != bt {
+		d.add(Change{Kind: ResultTypeChanged, RuleID: b.ID, Path: path, Old: at, New: bt})
+	}
+
+	for _, f := range diffSchemas(a.Schema, b.Schema) {
+		f.RuleID = b.ID
+		f.Path = path
+		d.add(f)
+	}
+
+	for _, f := range diffSchemas(Schema{Elements: a.ExtraElements}, Schema{Elements: b.ExtraElements}) {
+		f.RuleID = b.ID
+		f.Path = path
+		f.Field = "+" + f.Field
+		d.add(f)
+	}
+
+	for _, f := range diffEvalOptions(a.EvalOptions, b.EvalOptions) {
+		f.RuleID = b.ID
+		f.Path = path
+		d.add(f)
+	}
+
+	ao, bo := strings.Join(commonChildren(a, b), ","), strings.Join(commonChildren(b, a), ",")
+	if ao != bo {
+		d.add(Change{Kind: ChildOrderChanged, RuleID: b.ID, Path: path, Old: ao, New: bo})
+	}
+
+	ids := make([]string, 0, len(a.Rules)+len(b.Rules))
+	for k := range a.Rules {
+		ids = append(ids, k)
+	}
+	for k := range b.Rules {
+		if _, ok := a.Rules[k]; !ok {
+			ids = append(ids, k)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, k := range ids {
+		d.diffRules(a.Rules[k], b.Rules[k], path)
+	}
+}
+
+// movedInto reports the rules in the subtree of the added rule r, at path,
+// that were moved there from the old tree. The other rules in the subtree
+// are part of the addition of r.
+func (d *differ) movedInto(r *Rule, path string) {
+	ids := make([]string, 0, len(r.Rules))
+	for k := range r.Rules {
+		ids = append(ids, k)
+	}
+	sort.Strings(ids)
+
+	for _, k := range ids {
+		c := r.Rules[k]
+		if _, ok := d.oldByID[c.ID]; ok && d.movable(c.ID) {
+			d.diffRules(nil, c, path)
+			continue
+		}
+		d.movedInto(c, joinPath(path, c.ID))
+	}
+}
+
+func (d *differ) add(c Change) {
+	d.changes = append(d.changes, c)
+}
+
+// outputString formats a rule's fixed output, blank if there is none.
+func outputString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// commonChildren returns the IDs of the child rules of a that are also
+// child rules of b, in the order of a's child rules.
+func commonChildren(a, b *Rule) []string {
+	ids := []string{}
+	for _, k := range a.childOrder() {
+		if _, ok := b.Rules[k]; ok {
+			ids = append(ids, k)
+		}
+	}
+	return ids
+}
+
+// countIDs counts the number of times each rule ID appears in the tree.
+func countIDs(r *Rule, m map[string]int) map[string]int {
+	if r == nil {
+		return m
+	}
+	m[r.ID]++
+	for _, c := range r.Rules {
+		countIDs(c, m)
+	}
+	return m
+}
+
+// indexRules records each rule in the tree and its path.
+func indexRules(r *Rule, parent string, rules map[string]*Rule, paths map[string]string) {
+	if r == nil {
+		return
+	}
+	path := joinPath(parent, r.ID)
+	rules[r.ID] = r
+	paths[r.ID] = path
+	for _, c := range r.Rules {
+		indexRules(c, path, rules, paths)
+	}
+}
+
+// diffSchemas returns a change for a different schema ID, and for each data
+// element that was added, removed, changed type or became optional.
+func diffSchemas(a, b Schema) []Change {
+	changes := []Change{}
+	if a.ID != b.ID {
+		changes = append(changes, Change{Kind: SchemaChanged, Field: "id", Old: a.ID, New: b.ID})
+	}
+
+	typ := func(e DataElement) string {
+		if e.Optional {
+			return fmt.Sprintf("%v, optional", e.Type)
+		}
+		return fmt.Sprintf("%v", e.Type)
+	}
+
+	at := map[string]string{}
+	for _, e := range a.Elements {
+		at[e.Name] = typ(e)
+	}
+	bt := map[string]string{}
+	for _, e := range b.Elements {
+		bt[e.Name] = typ(e)
+	}
+
+	names := make([]string, 0, len(at)+len(bt))
+	for k := range at {
+		names = append(names, k)
+	}
+	for k := range bt {
+		if _, ok := at[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		if at[n] != bt[n] {
+			changes = append(changes, Change{Kind: SchemaChanged, Field: n, Old: at[n], New: bt[n]})
+		}
+	}
+	return changes
+}
+
+// String returns a table of the changes.
+func (c Changes) String() string {
+	tw := table.NewWriter()
+	tw.SetTitle("\nINDIGO RULE CHANGES\n")
+	tw.AppendHeader(table.Row{"\nRule", "\nChange", "\nField", "\nOld", "\nNew"})
+
+	maxWidthOfValueColumns := 40
+	maxValueLength := 0
+	for _, x := range c {
+		tw.AppendRow(table.Row{x.Path, x.Kind.String(), x.Field, x.Old, x.New})
+		if len(x.Old) > maxValueLength {
+			maxValueLength = len(x.Old)
+		}
+		if len(x.New) > maxValueLength {
+			maxValueLength = len(x.New)
+		}
+	}
+
+	tw.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1},
+		{Number: 2},
+		{Number: 3},
+		{Number: 4, WidthMax: maxWidthOfValueColumns},
+		{Number: 5, WidthMax: maxWidthOfValueColumns},
+	})
+
+	style := table.StyleLight
+	style.Format.Header = text.FormatDefault
+	// Only add the row separator if the values are wide enough to wrap.
+	if maxValueLength > maxWidthOfValueColumns {
+		style.Options.SeparateRows = true
+	}
+	tw.SetStyle(style)
+	return tw.Render()
+}
+
+// diffEvalOptions returns a change for each JSON-serializable evaluation
+// option that is different.
+func diffEvalOptions(a, b EvalOptions) []Change {
+	am := evalOptionsMap(a)
+	bm := evalOptionsMap(b)
+
+	keys := make([]string, 0, len(am))
+	for k := range am {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	changes := []Change{}
+	for _, k := range keys {
+		if string(am[k]) != string(bm[k]) {
+			changes = append(changes, Change{Kind: EvalOptionsChanged, Field: k, Old: string(am[k]), New: string(bm[k])})
+		}
+	}
+	return changes
+}
+
+// evalOptionsMap returns the JSON representation of each evaluation option.
+func evalOptionsMap(o EvalOptions) map[string]json.RawMessage {
+	m := map[string]json.RawMessage{}
+	b, err := json.Marshal(o)
+	if err != nil {
+		return m
+	}
+	_ = json.Unmarshal(b, &m)
+	return m
+}
+
+func joinPath(parent, id string) string {
+	if parent == "" {
+		return id
+	}
+	return parent + "/" + id
+}
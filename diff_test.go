@@ -0,0 +1,119 @@
+package indigo_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/matryer/is"
+)
+
+func TestDiff(t *testing.T) {
+	is := is.New(t)
+
+	a := makeRule()
+	is.Equal(len(indigo.Diff(a, makeRule())), 0)
+
+	b := makeRule()
+	// move b4 from B to D
+	b.Rules["D"].Rules["b4"] = b.Rules["B"].Rules["b4"]
+	delete(b.Rules["B"].Rules, "b4")
+	b.Rules["D"].Rules["b4"].Expr = `true`
+	b.Rules["E"].ResultType = indigo.Int{}
+	b.Rules["E"].Schema = indigo.Schema{
+		ID:       "x",
+		Elements: []indigo.DataElement{{Name: "a", Type: indigo.String{}}},
+	}
+	b.Rules["E"].EvalOptions.DiscardFail = indigo.Discard
+	b.Rules["D"].Rules["d1"].OnPass = []string{"notify", "log"}
+	b.Rules["E"].Rules["e1"].Disabled = true
+	b.Rules["E"].Rules["e1"].ExtraElements = []indigo.DataElement{{Name: "z", Type: indigo.Bool{}}}
+
+	want := indigo.Changes{
+		{Kind: indigo.RuleMoved, RuleID: "b4", Path: "rule1/D/b4", Old: "rule1/B/b4", New: "rule1/D/b4"},
+		{Kind: indigo.ExprChanged, RuleID: "b4", Path: "rule1/D/b4", Old: "false", New: "true"},
+		{Kind: indigo.ActionsChanged, RuleID: "d1", Path: "rule1/D/d1", Field: "on_pass", Old: "", New: "notify,log"},
+		{Kind: indigo.ResultTypeChanged, RuleID: "E", Path: "rule1/E", Old: "bool", New: "int"},
+		{Kind: indigo.SchemaChanged, RuleID: "E", Path: "rule1/E", Field: "id", Old: "", New: "x"},
+		{Kind: indigo.SchemaChanged, RuleID: "E", Path: "rule1/E", Field: "a", Old: "", New: "string"},
+		{Kind: indigo.EvalOptionsChanged, RuleID: "E", Path: "rule1/E", Field: "DiscardFail", Old: "0", New: "1"},
+		{Kind: indigo.DisabledChanged, RuleID: "e1", Path: "rule1/E/e1", Old: "false", New: "true"},
+		{Kind: indigo.SchemaChanged, RuleID: "e1", Path: "rule1/E/e1", Field: "+z", Old: "", New: "bool"},
+	}
+	got := indigo.Diff(a, b)
+	is.Equal(got, want)
+
+	s := got.String()
+	is.True(strings.Contains(s, "INDIGO RULE CHANGES"))
+	is.True(strings.Contains(s, "rule1/B/b4"))
+}
+
+// Rules moved into an added rule, or out of a removed rule, are reported as moved
+func TestDiffMoveSubtree(t *testing.T) {
+	is := is.New(t)
+
+	a := makeRule()
+
+	// move b4 under a new rule N
+	b := makeRule()
+	b.Rules["N"] = &indigo.Rule{ID: "N", Expr: `true`, Rules: map[string]*indigo.Rule{
+		"b4": b.Rules["B"].Rules["b4"],
+	}}
+	delete(b.Rules["B"].Rules, "b4")
+
+	want := indigo.Changes{
+		{Kind: indigo.RuleAdded, RuleID: "N", Path: "rule1/N", New: `true`},
+		{Kind: indigo.RuleMoved, RuleID: "b4", Path: "rule1/N/b4", Old: "rule1/B/b4", New: "rule1/N/b4"},
+	}
+	is.Equal(indigo.Diff(a, b), want)
+
+	// remove B, moving b1 to D and b4 under a new rule N
+	b = makeRule()
+	b.Rules["D"].Rules["b1"] = b.Rules["B"].Rules["b1"]
+	b.Rules["N"] = &indigo.Rule{ID: "N", Expr: `true`, Rules: map[string]*indigo.Rule{
+		"x": {ID: "x", Expr: `true`, Rules: map[string]*indigo.Rule{
+			"b4": b.Rules["B"].Rules["b4"],
+		}},
+	}}
+	delete(b.Rules, "B")
+
+	want = indigo.Changes{
+		{Kind: indigo.RuleRemoved, RuleID: "B", Path: "rule1/B", Old: a.Rules["B"].Expr},
+		{Kind: indigo.RuleMoved, RuleID: "b1", Path: "rule1/D/b1", Old: "rule1/B/b1", New: "rule1/D/b1"},
+		{Kind: indigo.RuleAdded, RuleID: "N", Path: "rule1/N", New: `true`},
+		{Kind: indigo.RuleMoved, RuleID: "b4", Path: "rule1/N/x/b4", Old: "rule1/B/b4", New: "rule1/N/x/b4"},
+	}
+	is.Equal(indigo.Diff(a, b), want)
+}
+
+func TestDiffDuplicateIDs(t *testing.T) {
+	is := is.New(t)
+
+	// Rules with IDs that are not unique are not tracked as moves
+	a := makeRule()
+	a.Rules["B"].Rules["x"] = &indigo.Rule{ID: "x"}
+	a.Rules["D"].Rules["x"] = &indigo.Rule{ID: "x"}
+
+	b := makeRule()
+	b.Rules["E"].Rules["x"] = &indigo.Rule{ID: "x"}
+
+	got := indigo.Diff(a, b)
+	is.Equal(len(got), 3)
+	is.Equal(got[0].Kind, indigo.RuleRemoved)
+	is.Equal(got[1].Kind, indigo.RuleRemoved)
+	is.Equal(got[2].Kind, indigo.RuleAdded)
+}
+
+func TestDiffChildOrder(t *testing.T) {
+	is := is.New(t)
+
+	a := makeRule()
+	b := makeRule()
+	is.NoErr(b.Rules["E"].MoveChild("e3", 0))
+	is.True(a.Hash() != b.Hash())
+
+	want := indigo.Changes{
+		{Kind: indigo.ChildOrderChanged, RuleID: "E", Path: "rule1/E", Old: "e1,e2,e3", New: "e3,e1,e2"},
+	}
+	is.Equal(indigo.Diff(a, b), want)
+}
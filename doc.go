@@ -42,11 +42,15 @@
 //
 // Updating Rules
 //
-// To add or remove rules, you do so by modifying the parent rule's map of Rules
-//   delete(parent.Rules, "child-id-to-delete")
+// To add, remove or reorder rules, use the parent rule's AddChild, RemoveChild and MoveChild methods
+//   parent.RemoveChild("child-id-to-delete")
 // and
 //   myNewRule.Compile(myCompiler)
-//   parent.Rules["my-new-rule"] = myNewRule
+//   parent.AddChild(myNewRule)
+//
+// Child rules are evaluated in the order they were added, unless a SortFunc is given in
+// the evaluation options. Rules can also be added by modifying the parent rule's map of Rules
+// directly; such rules are evaluated after the rules added with AddChild, in order of their IDs.
 //
 // It is not recommended to update a rule IN PLACE, unless you
 // manage the rule lifecycle beyond evaluation and use of the rule in interpreting
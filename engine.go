@@ -3,6 +3,7 @@ package indigo
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
 // Compiler is the interface that wraps the Compile method.
@@ -43,20 +44,138 @@ func NewEngine(e ExpressionCompilerEvaluator) *DefaultEngine {
 // options of each rule to determine what to do with the results, and whether to proceed
 // evaluating. Options passed to this function will override the options set on the rules.
 // Eval uses the Evaluator provided to the engine to perform the expression evaluation.
+//
+// If the Provider option is set, data elements missing from d are resolved
+// by the provider when the expressions first use them.
+//
+// If the RunActions option is set, the actions of the rules evaluated are
+// executed once the evaluation is complete (see Rule.OnPass). The actions
+// receive the data elements the provider resolved during the evaluation, but
+// not those it did not. If any action fails, Eval returns the Result along
+// with an *ActionError.
+//
+// If the RecordDecisions option is set and the decision cannot be recorded,
+// Eval returns the Result along with the sink's error.
 func (e *DefaultEngine) Eval(ctx context.Context, r *Rule,
 	d map[string]interface{}, opts ...EvalOption) (*Result, error) {
 
+	// Elements missing from the data are resolved by the provider when used
+	o := EvalOptions{}
+	applyEvaluatorOptions(&o, opts...)
+	if o.provider != nil && r != nil {
+		d = lazyData(ctx, r, d, o.provider)
+	}
+
+	if o.validateInput && r != nil {
+		if err := validateInput(r, d); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &evalState{}
+	u, err := e.eval(ctx, r, d, s, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var actionErr error
+	if reg := u.EvalOptions.actions; reg != nil {
+		actionErr = runActions(ctx, reg, s.actions, resolvedData(d), u.EvalOptions.dryRunActions)
+		u.Actions = s.actions
+	}
+
+	// A decision that cannot be recorded has still been made
+	if u.EvalOptions.decisionSink != nil {
+		if err := recordDecision(u.EvalOptions.decisionSink, r, d, u, s.time(u.EvalOptions)); err != nil {
+			if actionErr != nil {
+				return u, fmt.Errorf("rule %s: recording decision: %v; %w", r.ID, err, actionErr)
+			}
+			return u, fmt.Errorf("rule %s: recording decision: %w", r.ID, err)
+		}
+	}
+
+	if actionErr != nil {
+		return u, actionErr
+	}
+	return u, nil
+}
+
+// eval evaluates the rule and its children recursively. Rules that other
+// rules depend on are only evaluated once; their results are kept in s.
+func (e *DefaultEngine) eval(ctx context.Context, r *Rule,
+	d map[string]interface{}, s *evalState, opts ...EvalOption) (*Result, error) {
+
+	if u, ok := s.results[r]; ok {
+		return u, nil
+	}
+
+	u, err := e.evalRule(ctx, r, d, s, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.EvalOptions.actions != nil {
+		s.actions = append(s.actions, firedActions(u)...)
+	}
+
+	if r.referenced {
+		if s.results == nil {
+			s.results = map[*Rule]*Result{}
+		}
+		s.results[r] = u
+	}
+	return u, nil
+}
+
+// evalRule evaluates the rule's expression, and its children.
+func (e *DefaultEngine) evalRule(ctx context.Context, r *Rule,
+	d map[string]interface{}, s *evalState, opts ...EvalOption) (*Result, error) {
+
 	if err := validateEvalArguments(r, e, d); err != nil {
 		return nil, err
 	}
 
 	o := r.EvalOptions
 	applyEvaluatorOptions(&o, opts...)
+
+	// Disabled rules, and rules outside their effective period, are not evaluated
+	if r.Disabled || (r.scheduled() && !r.InEffect(s.time(o))) {
+		return &Result{
+			Rule:        r,
+			RuleVersion: r.Version,
+			RuleHash:    r.hash,
+			Skipped:     true,
+			Results:     map[string]*Result{},
+			EvalOptions: o,
+		}, nil
+	}
+
 	setSelfKey(r, d)
 
-	//	fmt.Println("Rule ID", r.ID, "return diags?", o.ReturnDiagnostics)
+	var start time.Time
+	if o.ReturnDiagnostics {
+		start = time.Now()
+	}
+
+	// The expression sees the results of the rules it depends on
+	data := d
+	schema := r.EffectiveSchema()
+	if len(r.DependsOn) > 0 {
+		var err error
+		if data, err = e.dependencyData(ctx, r, d, s, opts...); err != nil {
+			return nil, err
+		}
+		if schema, err = r.ExpressionSchema(schema); err != nil {
+			return nil, err
+		}
+	}
+
+	// The parameters of a rule created from a compiled template are variables
+	if r.template != nil {
+		data = r.template.bind(data)
+	}
 
-	val, diagnostics, err := e.e.Evaluate(d, r.Expr, r.Schema, r.Self, r.Program, defaultResultType(r), o.ReturnDiagnostics)
+	val, diagnostics, err := e.e.Evaluate(data, r.Expr, schema, r.Self, r.Program, defaultResultType(r), o.ReturnDiagnostics)
 	if err != nil {
 		return nil, fmt.Errorf("rule %s: %w", r.ID, err)
 	}
@@ -65,6 +184,8 @@ func (e *DefaultEngine) Eval(ctx context.Context, r *Rule,
 
 	u := &Result{
 		Rule:           r,
+		RuleVersion:    r.Version,
+		RuleHash:       r.hash,
 		ExpressionPass: true,                                   // default boolean result
 		Results:        make(map[string]*Result, len(r.Rules)), // TODO: consider how large to make it
 		Value:          val,
@@ -72,10 +193,22 @@ func (e *DefaultEngine) Eval(ctx context.Context, r *Rule,
 		EvalOptions:    o,
 	}
 
+	if o.ReturnDiagnostics {
+		defer func() {
+			u.Duration = time.Since(start)
+		}()
+	}
+
 	// If the evaluation returned a boolean, set the Result's value,
 	// otherwise keep the default, true
 	if pass, ok := val.(bool); ok {
 		u.ExpressionPass = pass
+		u.conditionTrue = pass
+	}
+
+	// A rule with a fixed output returns it in place of the expression's value
+	if r.Output != nil && u.ExpressionPass {
+		u.Value = r.Output
 	}
 
 	// By default, the rule's pass/fail is determined by the pass/fail of the
@@ -89,12 +222,19 @@ func (e *DefaultEngine) Eval(ctx context.Context, r *Rule,
 		return u, nil
 	}
 
-	// count the number of failed and passed children
+	// count the number of failed, passed and skipped children
 	var failCount int
 	var passCount int
+	var skipCount int
+
+	// the sum of the weights of the children that passed
+	var passWeight float64
+
+	// the child results that passed, in evaluation order, if a hit policy is set
+	var matches []*Result
 
 done: // break out of inner switch
-	for _, cr := range r.sortChildRules(o.SortFunc, o.overrideSort) {
+	for _, cr := range r.sortChildRules(o.sortFunc(), o.overrideSort) {
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
@@ -103,11 +243,18 @@ done: // break out of inner switch
 				u.RulesEvaluated = append(u.RulesEvaluated, cr)
 			}
 
-			result, err := e.Eval(ctx, cr, d, opts...)
+			result, err := e.eval(ctx, cr, d, s, opts...)
 			if err != nil {
 				return nil, err
 			}
 
+			// Skipped child rules are reported, but do not count as passed or failed
+			if result.Skipped {
+				u.Results[cr.ID] = result
+				skipCount++
+				continue
+			}
+
 			// If the child rule failed, either due to its own expression evaluation
 			// or its children, we have encountered a failure, and we'll count it
 			// The reason to keep this count, rather than look at the child results,
@@ -115,6 +262,7 @@ done: // break out of inner switch
 			switch result.Pass {
 			case true:
 				passCount++
+				passWeight += cr.Weight
 			case false:
 				failCount++
 			}
@@ -137,6 +285,13 @@ done: // break out of inner switch
 				}
 			}
 
+			if o.HitPolicy != HitPolicyNone && result.Pass && result.conditionTrue {
+				matches = append(matches, result)
+				if o.HitPolicy == HitFirst {
+					break done
+				}
+			}
+
 			if o.StopFirstPositiveChild && result.Pass {
 				break done
 			}
@@ -147,13 +302,30 @@ done: // break out of inner switch
 		}
 	}
 
+	// With a hit policy, the matching child rules determine the result of the parent rule
+	if o.HitPolicy != HitPolicyNone && len(r.Rules) > 0 {
+		if err := applyHitPolicy(u, o.HitPolicy, o.Aggregation, matches); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+		return u, nil
+	}
+
+	// With a roll-up other than the default, the number (or weight) of the
+	// child rules that passed determines the result of the parent rule
+	if o.RollUp != RollUpAll && len(r.Rules) > 0 {
+		if err := applyRollUp(u, o, passCount, passWeight); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+		return u, nil
+	}
+
 	// Based on the results of the child rules, determine the result of the parent rule
 	switch r.EvalOptions.TrueIfAny {
 	case true:
 		if u.ExpressionPass {
 			// If none of the child rules passed AND the parent's expression passed, the rule
 			// shouldn't pass
-			hasChildren := len(r.Rules) > 0
+			hasChildren := len(r.Rules)-skipCount > 0
 			if hasChildren && passCount == 0 {
 				u.Pass = false
 			}
@@ -171,36 +343,78 @@ done: // break out of inner switch
 // Compile uses the Evaluator's compile method to check the rule and its children,
 // returning any validation errors. Stores a compiled version of the rule in the
 // rule.Program field (if the compiler returns a program).
+//
+// Compile also resolves the dependencies between rules in the tree (see
+// Rule.DependsOn), returning an error if there is a dependency cycle, and the
+// schemas child rules inherit from their parents (see Rule.EffectiveSchema).
+// Since the rule r has no parent, its own schema is used.
 func (e *DefaultEngine) Compile(r *Rule, opts ...CompilationOption) error {
-	if err := validateCompileArguments(r, e); err != nil {
+	o := compileOptions{}
+	applyCompilerOptions(&o, opts...)
+
+	if err := e.compile(r, Schema{}, o); err != nil {
 		return err
 	}
 
-	o := compileOptions{}
-	applyCompilerOptions(&o, opts...)
+	return resolveDependencies(r, o.dryRun)
+}
+
+// compile compiles the rule and its children recursively. The schema
+// inherited is the effective schema of the rule's parent.
+func (e *DefaultEngine) compile(r *Rule, inherited Schema, o compileOptions) error {
+	if err := validateCompileArguments(r, e); err != nil {
+		return err
+	}
 
 	resultType := r.ResultType
 	if resultType == nil {
 		resultType = Bool{}
 	}
 
-	prg, err := e.e.Compile(r.Expr, r.Schema, resultType, o.collectDiagnostics, o.dryRun)
+	effective, err := r.ResolveSchema(inherited)
+	if err != nil {
+		return err
+	}
+
+	schema, err := r.ExpressionSchema(effective)
 	if err != nil {
-		return fmt.Errorf("rule %s: %w", r.ID, err)
+		return err
+	}
+
+	// A rule created from a compiled template uses the template's program,
+	// unless its expression has been changed
+	if b := r.template; b != nil && b.expr == r.Expr && len(r.DependsOn) == 0 {
+		if !o.dryRun {
+			r.Program = b.program
+		}
+	} else {
+		prg, err := e.e.Compile(r.Expr, schema, resultType, o.collectDiagnostics, o.dryRun)
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+
+		if !o.dryRun {
+			r.Program = prg
+			r.template = nil
+		}
 	}
 
 	if !o.dryRun {
-		r.Program = prg
+		r.effective = &effective
 	}
 
-	for _, cr := range r.Rules {
-		err := e.Compile(cr, opts...)
+	for _, cr := range r.orderedChildren() {
+		err := e.compile(cr, effective, o)
 		if err != nil {
 			return err
 		}
 	}
 
-	r.sortedRules = r.sortChildRules(r.EvalOptions.SortFunc, true)
+	r.sortedRules = r.sortChildRules(r.EvalOptions.sortFunc(), true)
+
+	if !o.dryRun {
+		r.hash = r.contentHash(func(c *Rule) string { return c.hash })
+	}
 
 	return nil
 }
@@ -271,6 +485,27 @@ type EvalOptions struct {
 	// Default: all rules are returned
 	DiscardFail FailAction
 
+	// Specify how the results of the child rules determine whether the parent
+	// rule passes. See RollUp for the available modes. Setting a roll-up other
+	// than RollUpAll overrides TrueIfAny.
+	// Default: RollUpAll
+	RollUp RollUp `json:"roll_up,omitempty"`
+
+	// The number of child rules that must pass (RollUpAtLeast), or the sum of
+	// the weights of the child rules that must pass (RollUpWeighted).
+	Threshold float64 `json:"threshold,omitempty"`
+
+	// Select among the matching (passing) child rules, and combine their values
+	// into the parent rule's output, following a DMN-style hit policy.
+	// See HitPolicy for the available policies.
+	// Default: HitPolicyNone
+	HitPolicy HitPolicy `json:"hit_policy,omitempty"`
+
+	// Specify how the values of the matching child rules are combined by the
+	// HitCollect hit policy.
+	// Default: CollectList
+	Aggregation Aggregation `json:"aggregation,omitempty"`
+
 	// Include diagnostic information with the results.
 	// To enable this option, you must first turn on diagnostic
 	// collection at the engine level with the CollectDiagnostics EngineOption.
@@ -287,6 +522,12 @@ type EvalOptions struct {
 	// Default: No sort
 	SortFunc func(rules []*Rule, i, j int) bool `json:"-"`
 
+	// Sort the child rules by their Priority, highest first, before evaluation.
+	// Rules with the same priority are sorted by ID.
+	// Ignored if SortFunc is set.
+	// Use case: select the highest priority matching rule with StopFirstPositiveChild.
+	SortByPriority bool `json:"sort_by_priority,omitempty"`
+
 	// this special field is updated by the SortFunc option. It is necessary
 	// because we need to know if the local rule-specific sort funtion
 	// is being overriden by the a global option.
@@ -294,6 +535,38 @@ type EvalOptions struct {
 	//  (2) Rule did not supply its own sort
 	// and was overridden by a global eval option,
 	overrideSort bool
+
+	// decisionSink receives a record of the evaluation. Set by the
+	// RecordDecisions option.
+	decisionSink DecisionSink
+
+	// actions holds the actions executed after evaluation. Set by the
+	// RunActions option.
+	actions *ActionRegistry
+
+	// dryRunActions lists the actions that would be executed, without
+	// executing them. Set by the DryRunActions option.
+	dryRunActions bool
+
+	// clock returns the time of the evaluation. Set by the Clock option.
+	clock func() time.Time
+
+	// provider resolves the data elements missing from the input data. Set
+	// by the Provider option.
+	provider DataProvider
+
+	// validateInput checks the input data against the rules' schemas before
+	// evaluation. Set by the ValidateInput option.
+	validateInput bool
+}
+
+// sortFunc returns the function used to sort child rules: SortFunc, or
+// SortRulesPriority if SortByPriority is set.
+func (o EvalOptions) sortFunc() func(rules []*Rule, i, j int) bool {
+	if o.SortFunc == nil && o.SortByPriority {
+		return SortRulesPriority
+	}
+	return o.SortFunc
 }
 
 // FailAction is used to tell Indigo what to do with the results of
@@ -339,6 +612,67 @@ func SortFunc(x func(rules []*Rule, i, j int) bool) EvalOption {
 	}
 }
 
+// SortByPriority specifies that child rules are sorted by their Priority
+// before evaluation, highest first. Setting it to true replaces any SortFunc
+// set on the rules.
+func SortByPriority(b bool) EvalOption {
+	return func(f *EvalOptions) {
+		if b {
+			f.SortFunc = nil
+		}
+		f.SortByPriority = b
+		f.overrideSort = true
+	}
+}
+
+// AtLeast specifies that a parent rule passes if at least n of its
+// child rules pass.
+func AtLeast(n int) EvalOption {
+	return func(f *EvalOptions) {
+		f.RollUp = RollUpAtLeast
+		f.Threshold = float64(n)
+	}
+}
+
+// Weighted specifies that a parent rule passes if the sum of the weights of
+// its child rules that pass is at least the threshold.
+func Weighted(threshold float64) EvalOption {
+	return func(f *EvalOptions) {
+		f.RollUp = RollUpWeighted
+		f.Threshold = threshold
+	}
+}
+
+// NoneOf specifies that a parent rule passes only if none of its child rules pass.
+func NoneOf() EvalOption {
+	return func(f *EvalOptions) {
+		f.RollUp = RollUpNone
+	}
+}
+
+// ExactlyOneOf specifies that a parent rule passes only if exactly one of its
+// child rules passes.
+func ExactlyOneOf() EvalOption {
+	return func(f *EvalOptions) {
+		f.RollUp = RollUpExactlyOne
+	}
+}
+
+// Hit specifies the hit policy used to select among the matching child rules.
+func Hit(h HitPolicy) EvalOption {
+	return func(f *EvalOptions) {
+		f.HitPolicy = h
+	}
+}
+
+// Aggregate specifies how the HitCollect hit policy combines the values of
+// the matching child rules.
+func Aggregate(a Aggregation) EvalOption {
+	return func(f *EvalOptions) {
+		f.Aggregation = a
+	}
+}
+
 // DiscardFail specifies whether to omit failed rules from the results.
 func DiscardFail(k FailAction) EvalOption {
 	return func(f *EvalOptions) {
@@ -377,6 +711,76 @@ func StopFirstPositiveChild(b bool) EvalOption {
 	}
 }
 
+// RecordDecisions specifies that a record of the evaluation, including the
+// input data, the version of the rule tree, the evaluation options and the
+// results, is sent to the sink once the rule tree has been evaluated. See Replay
+// for re-evaluating recorded decisions.
+//
+// If the sink returns an error, Eval returns it along with the Result; the
+// evaluation itself is not affected, so callers may choose to use the Result
+// and only log the error.
+func RecordDecisions(sink DecisionSink) EvalOption {
+	return func(f *EvalOptions) {
+		f.decisionSink = sink
+	}
+}
+
+// RunActions specifies that the actions of the rules evaluated (see Rule.OnPass
+// and Rule.OnFail) are executed once the rule tree has been evaluated, using
+// the actions in the registry. The actions are executed in the order the rules
+// finished evaluating: child rules before their parent, siblings in evaluation
+// order, and the actions of a rule in the order they are listed. Rules that
+// were not evaluated, such as those skipped by StopFirstPositiveChild, do not
+// fire their actions; rules whose results were discarded do.
+//
+// An action that returns an error does not stop the other actions from being
+// executed. The outcome of every action is recorded in the root Result's
+// Actions field.
+func RunActions(reg *ActionRegistry) EvalOption {
+	return func(f *EvalOptions) {
+		f.actions = reg
+	}
+}
+
+// DryRunActions specifies that the actions that would be executed by RunActions
+// are listed in the root Result's Actions field, but not executed.
+func DryRunActions(b bool) EvalOption {
+	return func(f *EvalOptions) {
+		f.dryRunActions = b
+	}
+}
+
+// Clock specifies the function that returns the time of the evaluation, used
+// to decide whether rules are in effect (see Rule.EffectiveFrom). The clock is
+// read at most once per call to Eval, so that all rules are evaluated at the
+// same time. Use it to test rules ahead of their effective period.
+// Default: time.Now
+func Clock(now func() time.Time) EvalOption {
+	return func(f *EvalOptions) {
+		f.clock = now
+	}
+}
+
+// Provider specifies a DataProvider that resolves the data elements declared
+// in the rules' schemas that are missing from the input data, the first time
+// an expression uses them (see LazyValue). The data passed to Eval may be
+// nil. Each element is resolved at most once per call to Eval.
+func Provider(p DataProvider) EvalOption {
+	return func(f *EvalOptions) {
+		f.provider = p
+	}
+}
+
+// ValidateInput specifies that the input data is checked against the schemas
+// of the rule and its descendants before evaluation (see Schema.Validate).
+// If the data does not match, Eval returns a *ValidationError listing the
+// violations, without evaluating any rules.
+func ValidateInput(b bool) EvalOption {
+	return func(f *EvalOptions) {
+		f.validateInput = b
+	}
+}
+
 // See the EvalOptions struct for documentation.
 func applyEvaluatorOptions(o *EvalOptions, opts ...EvalOption) {
 	for _, opt := range opts {
@@ -1158,3 +1158,114 @@ func TestTimeout(t *testing.T) {
 	_, err := e.Eval(ctx, r, map[string]interface{}{})
 	is.True(errors.Is(err, context.DeadlineExceeded))
 }
+
+// Test that disabled child rules are reported as skipped, without failing the parent
+func TestDisabledRules(t *testing.T) {
+	is := is.New(t)
+	e := indigo.NewEngine(newMockEvaluator())
+
+	r := makeRule()
+	r.Rules["D"].Rules["d2"].Disabled = true
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	d2 := u.Results["D"].Results["d2"]
+	is.True(d2.Skipped)
+	is.True(!d2.Pass)
+	is.True(u.Results["D"].Pass) // d1 and d3 pass
+	is.True(strings.Contains(u.String(), "SKIP"))
+
+	// the root passes once the failing rules are switched off
+	r.Rules["B"].Disabled = true
+	r.Rules["E"].Disabled = true
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	is.True(u.Pass)
+	is.Equal(len(u.Results), 3)
+	is.Equal(len(u.Results["B"].Results), 0) // the children of skipped rules are not evaluated
+
+	// with TrueIfAny, a rule whose children are all skipped passes on its own expression
+	r = makeRule()
+	r.Rules["D"].EvalOptions.TrueIfAny = true
+	for _, c := range r.Rules["D"].Rules {
+		c.Disabled = true
+	}
+	is.NoErr(e.Compile(r))
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	is.True(u.Results["D"].Pass)
+
+	// the root rule can be skipped too
+	r.Disabled = true
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	is.True(u.Skipped)
+	is.Equal(len(u.Results), 0)
+}
+
+// Test that rules are only evaluated during their effective period, using the evaluation clock
+func TestEffectivePeriod(t *testing.T) {
+	is := is.New(t)
+	e := indigo.NewEngine(newMockEvaluator())
+
+	june := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	sept := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	r := makeRule()
+	summer := r.Rules["D"].Rules["d2"]
+	summer.EffectiveFrom = june
+	summer.EffectiveUntil = sept
+	is.NoErr(e.Compile(r))
+
+	cases := []struct {
+		now     time.Time
+		skipped bool
+	}{
+		{now: june.Add(-time.Second), skipped: true},
+		{now: june, skipped: false},
+		{now: sept.Add(-time.Second), skipped: false},
+		{now: sept, skipped: true},
+	}
+
+	for _, c := range cases {
+		is.Equal(summer.InEffect(c.now), !c.skipped)
+
+		calls := 0
+		clock := func() time.Time {
+			calls++
+			return c.now
+		}
+		u, err := e.Eval(context.Background(), r, map[string]interface{}{}, indigo.Clock(clock))
+		is.NoErr(err)
+		is.Equal(u.Results["D"].Results["d2"].Skipped, c.skipped)
+		is.Equal(u.Results["D"].Pass, c.skipped) // d2 fails when it is in effect
+		is.Equal(calls, 1)
+	}
+
+	// open-ended periods
+	summer.EffectiveUntil = time.Time{}
+	is.True(summer.InEffect(sept.AddDate(10, 0, 0)))
+	is.True(!summer.InEffect(june.Add(-time.Second)))
+}
+
+// Test that the effective period is kept when a rule is encoded as JSON, and omitted if unbounded
+func TestEffectivePeriodJSON(t *testing.T) {
+	is := is.New(t)
+
+	r := makeRule()
+	r.Rules["D"].EffectiveFrom = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	r.Rules["E"].Disabled = true
+
+	b, err := json.Marshal(r)
+	is.NoErr(err)
+	is.Equal(strings.Count(string(b), "effective_from"), 1)
+	is.Equal(strings.Count(string(b), "effective_until"), 0)
+
+	r2 := &indigo.Rule{}
+	is.NoErr(json.Unmarshal(b, r2))
+	is.True(r2.Rules["D"].EffectiveFrom.Equal(r.Rules["D"].EffectiveFrom))
+	is.True(r2.Rules["E"].Disabled)
+	is.Equal(r2.Hash(), r.Hash())
+	is.True(r.Hash() != makeRule().Hash())
+}
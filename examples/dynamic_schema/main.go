@@ -9,10 +9,8 @@ import (
 	"github.com/ezachrisen/indigo/cel"
 	_ "github.com/mattn/go-sqlite3"
 	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
-	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 // Example showing how to load a schema and rules from a
@@ -20,18 +18,22 @@ import (
 //
 // Rather than import the the proto messages at compile time,
 // the types are loaded dynamically at runtime from a descriptor set
-// (school.descriptor).
+// (school.descriptor), which also provides a schema with an element
+// for each message.
 func main() {
 
 	schemas := map[string]*indigo.Schema{}
 
-	err := loadProtoDescriptors("school.descriptor")
+	ds, err := loadProtoDescriptors("school.descriptor")
 	if err != nil {
 		fmt.Println("Error loading proto descriptors:", err)
 		return
 	}
 
+	schemas[ds.ID] = ds
 	fmt.Println("Loaded proto descriptors")
+	fmt.Println("Schema generated from the descriptors:")
+	fmt.Println(ds)
 
 	db, err := sql.Open("sqlite3", "rules.db")
 	if err != nil {
@@ -68,60 +70,33 @@ func main() {
 
 }
 
-func loadProtoDescriptors(fname string) error {
+// loadProtoDescriptors registers the types in the descriptor set file, and
+// returns a schema with an element for each message in it.
+func loadProtoDescriptors(fname string) (*indigo.Schema, error) {
 
 	protoFile, err := ioutil.ReadFile(fname)
 	if err != nil {
-		return fmt.Errorf("reading file: %w", err)
+		return nil, fmt.Errorf("reading file: %w", err)
 	}
 
 	set := new(descriptorpb.FileDescriptorSet)
 	if err := proto.Unmarshal(protoFile, set); err != nil {
-		return fmt.Errorf("unmarshaling proto file: %w", err)
+		return nil, fmt.Errorf("unmarshaling proto file: %w", err)
 	}
 
-	fds := set.GetFile()
-	for _, fdproto := range fds {
-
-		// Initialize the File descriptor object
-		fd, err := protodesc.NewFile(fdproto, protoregistry.GlobalFiles)
-		if err != nil {
-			return fmt.Errorf("creating new file descriptor: %w", err)
-		}
-
-		existing, _ := protoregistry.GlobalFiles.FindFileByPath(fd.Path())
-		if existing != nil {
-			continue
-		}
-
-		err = protoregistry.GlobalFiles.RegisterFile(fd)
-		if err != nil {
-			return fmt.Errorf("registering file descriptor: %w", err)
-		}
-
-		// Register the messages
-		mds := fd.Messages()
-		for i := 0; i < mds.Len(); i++ {
-			m := mds.Get(i)
-			msg := dynamicpb.NewMessage(m)
-			if msg == nil {
-				return fmt.Errorf("getting dynamic message: %w", err)
-			}
-			err := protoregistry.GlobalTypes.RegisterMessage(msg.ProtoReflect().Type())
-			if err != nil {
-				return fmt.Errorf("registering message: %w", err)
-			}
-		}
-
+	s, err := indigo.SchemaFromDescriptors(set)
+	if err != nil {
+		return nil, fmt.Errorf("creating schema from descriptors: %w", err)
 	}
+	s.ID = "school_messages"
 
 	// Check that we can get one of the messages in our descriptor file
 	_, err = protoregistry.GlobalTypes.FindMessageByName("testdata.school.StudentSummary")
 	if err != nil {
-		return fmt.Errorf("finding message by name: %w", err)
+		return nil, fmt.Errorf("finding message by name: %w", err)
 	}
 
-	return nil
+	return &s, nil
 }
 
 func loadSchema(id string, db *sql.DB) (*indigo.Schema, error) {
@@ -0,0 +1,297 @@
+package indigo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// HitPolicy specifies how a parent rule selects among its matching child
+// rules, and how the matching child rules' values are combined into the
+// parent rule's output.
+//
+// A child rule matches if its expression, the condition, returns true, and
+// the rule passes. Expressions that return values other than booleans do not
+// match, since any such value would count as passing. The value of a
+// matching child rule is its Result.Value: its Output (see Rule.Output), the
+// output of its own hit policy, or true. Child rules used with a hit policy
+// therefore usually have a boolean expression and an Output, like the rows
+// of a DecisionTable.
+//
+// The hit policies are modeled on the hit policies of DMN decision tables.
+// When a hit policy is set, the parent rule passes if its own expression
+// passes and at least one child rule matches, and the output of the hit
+// policy replaces the parent rule's Result.Value. The TrueIfAny option is
+// ignored. Hit policies have no effect on rules without child rules.
+type HitPolicy int
+
+const (
+	// HitPolicyNone means that no hit policy is applied: the parent rule's
+	// pass/fail is determined by the TrueIfAny option, and its value
+	// is the value of its expression.
+	HitPolicyNone HitPolicy = iota
+
+	// HitUnique means that at most one child rule may match. The output is
+	// the value of the matching child rule. Evaluation fails if more than one
+	// child rule matches.
+	HitUnique
+
+	// HitFirst means that the output is the value of the first matching
+	// child rule, in evaluation order. Child rules after the first match are
+	// not evaluated.
+	HitFirst
+
+	// HitPriority means that the output is the value of the matching child
+	// rule with the highest Priority. Ties are broken by rule ID.
+	HitPriority
+
+	// HitAny means that all matching child rules must have the same value,
+	// which is the output. Evaluation fails if the values differ.
+	HitAny
+
+	// HitCollect means that the values of all matching child rules are
+	// combined by the Aggregation option.
+	HitCollect
+
+	// HitRuleOrder means that the output is a list of the values of all
+	// matching child rules, in evaluation order.
+	HitRuleOrder
+)
+
+// String returns the DMN name of the hit policy.
+func (h HitPolicy) String() string {
+	switch h {
+	case HitPolicyNone:
+		return "NONE"
+	case HitUnique:
+		return "UNIQUE"
+	case HitFirst:
+		return "FIRST"
+	case HitPriority:
+		return "PRIORITY"
+	case HitAny:
+		return "ANY"
+	case HitCollect:
+		return "COLLECT"
+	case HitRuleOrder:
+		return "RULE ORDER"
+	default:
+		return fmt.Sprintf("HitPolicy(%d)", int(h))
+	}
+}
+
+// Aggregation specifies how the HitCollect hit policy combines the values
+// of the matching child rules.
+type Aggregation int
+
+const (
+	// CollectList means that the output is a list ([]interface{}) of the
+	// values of the matching child rules, in evaluation order.
+	CollectList Aggregation = iota
+
+	// CollectSum means that the output is the sum of the values. If all
+	// values are integers, the sum is an int64, otherwise a float64.
+	CollectSum
+
+	// CollectMin means that the output is the smallest value.
+	CollectMin
+
+	// CollectMax means that the output is the largest value.
+	CollectMax
+
+	// CollectCount means that the output is the number of matching
+	// child rules, as an int64.
+	CollectCount
+)
+
+// String returns the DMN name of the aggregation.
+func (a Aggregation) String() string {
+	switch a {
+	case CollectList:
+		return "LIST"
+	case CollectSum:
+		return "SUM"
+	case CollectMin:
+		return "MIN"
+	case CollectMax:
+		return "MAX"
+	case CollectCount:
+		return "COUNT"
+	default:
+		return fmt.Sprintf("Aggregation(%d)", int(a))
+	}
+}
+
+// applyHitPolicy sets the pass/fail and value of the parent result u, based
+// on the child results that matched, in evaluation order.
+func applyHitPolicy(u *Result, h HitPolicy, a Aggregation, matches []*Result) error {
+	u.Pass = u.ExpressionPass && len(matches) > 0
+
+	switch h {
+	case HitUnique:
+		if len(matches) > 1 {
+			return fmt.Errorf("hit policy %s: %d child rules matched: %s", h, len(matches), matchIDs(matches))
+		}
+		u.Value = firstValue(matches)
+	case HitFirst:
+		u.Value = firstValue(matches)
+	case HitPriority:
+		if len(matches) == 0 {
+			u.Value = nil
+			return nil
+		}
+		rules := make([]*Rule, len(matches))
+		for i := range matches {
+			rules[i] = matches[i].Rule
+		}
+		best := 0
+		for i := 1; i < len(rules); i++ {
+			if SortRulesPriority(rules, i, best) {
+				best = i
+			}
+		}
+		u.Value = matches[best].Value
+	case HitAny:
+		for _, m := range matches {
+			if !valuesEqual(matches[0].Value, m.Value) {
+				return fmt.Errorf("hit policy %s: child rules %s and %s have different values: %v, %v",
+					h, matches[0].Rule.ID, m.Rule.ID, matches[0].Value, m.Value)
+			}
+		}
+		u.Value = firstValue(matches)
+	case HitCollect:
+		v, err := aggregate(a, matches)
+		if err != nil {
+			return fmt.Errorf("hit policy %s %s: %w", h, a, err)
+		}
+		u.Value = v
+	case HitRuleOrder:
+		u.Value = matchValues(matches)
+	default:
+		return fmt.Errorf("unknown hit policy %s", h)
+	}
+	return nil
+}
+
+// firstValue returns the value of the first result, or nil if there are none.
+func firstValue(matches []*Result) interface{} {
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches[0].Value
+}
+
+// matchValues returns the values of the results, in order.
+func matchValues(matches []*Result) []interface{} {
+	l := make([]interface{}, 0, len(matches))
+	for _, m := range matches {
+		l = append(l, m.Value)
+	}
+	return l
+}
+
+// matchIDs returns a sorted, comma-separated list of the rule IDs of the results.
+func matchIDs(matches []*Result) string {
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, m.Rule.ID)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ", ")
+}
+
+// aggregate combines the values of the results.
+func aggregate(a Aggregation, matches []*Result) (interface{}, error) {
+	switch a {
+	case CollectList:
+		return matchValues(matches), nil
+	case CollectCount:
+		return int64(len(matches)), nil
+	case CollectSum, CollectMin, CollectMax:
+	default:
+		return nil, fmt.Errorf("unknown aggregation")
+	}
+
+	if len(matches) == 0 {
+		if a == CollectSum {
+			return int64(0), nil
+		}
+		return nil, nil
+	}
+
+	allInts := true
+	var isum int64
+	var fsum float64
+	best := 0
+	var bestVal float64
+
+	for i, m := range matches {
+		f, isInt, ok := toNumber(m.Value)
+		if !ok {
+			return nil, fmt.Errorf("child rule %s: value %v (%T) is not a number", m.Rule.ID, m.Value, m.Value)
+		}
+		allInts = allInts && isInt
+		if isInt {
+			isum += toInt64(m.Value)
+		}
+		fsum += f
+
+		if i == 0 || (a == CollectMin && f < bestVal) || (a == CollectMax && f > bestVal) {
+			best = i
+			bestVal = f
+		}
+	}
+
+	if a == CollectSum {
+		if allInts {
+			return isum, nil
+		}
+		return fsum, nil
+	}
+	return matches[best].Value, nil
+}
+
+// toNumber converts a numeric value to a float64, reporting whether
+// the value is an integer type.
+func toNumber(v interface{}) (f float64, isInt bool, ok bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true, true
+	case int32:
+		return float64(x), true, true
+	case int64:
+		return float64(x), true, true
+	case uint:
+		return float64(x), true, true
+	case uint32:
+		return float64(x), true, true
+	case uint64:
+		return float64(x), true, true
+	case float32:
+		return float64(x), false, true
+	case float64:
+		return x, false, true
+	default:
+		return 0, false, false
+	}
+}
+
+// toInt64 converts an integer value to an int64.
+func toInt64(v interface{}) int64 {
+	switch x := v.(type) {
+	case int:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case int64:
+		return x
+	case uint:
+		return int64(x)
+	case uint32:
+		return int64(x)
+	case uint64:
+		return int64(x)
+	default:
+		return 0
+	}
+}
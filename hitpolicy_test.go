@@ -0,0 +1,147 @@
+package indigo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/matryer/is"
+)
+
+// makeHitRule returns a rule whose children c1, c2 and c4 match, with the
+// outputs 3, 5 and 1. c3's condition is false, and c5 returns a value
+// rather than a condition, so neither matches.
+func makeHitRule() *indigo.Rule {
+	r := indigo.NewRule("root", "true")
+	for _, c := range []*indigo.Rule{
+		{ID: "c1", Expr: "true", Output: int64(3), Priority: 1},
+		{ID: "c2", Expr: "true", Output: int64(5), Priority: 2},
+		{ID: "c3", Expr: "false", Output: int64(7)},
+		{ID: "c4", Expr: "true", Output: int64(1), Priority: 2},
+		{ID: "c5", Expr: "self", Self: int64(9), Priority: 3},
+	} {
+		_ = r.AddChild(c)
+	}
+	return r
+}
+
+func TestHitPolicy(t *testing.T) {
+	is := is.New(t)
+	e := indigo.NewEngine(newMockEvaluator())
+	r := makeHitRule()
+	is.NoErr(e.Compile(r))
+
+	cases := []struct {
+		opts []indigo.EvalOption
+		want interface{}
+	}{
+		{[]indigo.EvalOption{indigo.Hit(indigo.HitFirst)}, int64(3)},
+		{[]indigo.EvalOption{indigo.Hit(indigo.HitPriority)}, int64(5)}, // c2 and c4 tie; c2 wins by ID
+		{[]indigo.EvalOption{indigo.Hit(indigo.HitRuleOrder)}, []interface{}{int64(3), int64(5), int64(1)}},
+		{[]indigo.EvalOption{indigo.Hit(indigo.HitCollect)}, []interface{}{int64(3), int64(5), int64(1)}},
+		{[]indigo.EvalOption{indigo.Hit(indigo.HitCollect), indigo.Aggregate(indigo.CollectSum)}, int64(9)},
+		{[]indigo.EvalOption{indigo.Hit(indigo.HitCollect), indigo.Aggregate(indigo.CollectMin)}, int64(1)},
+		{[]indigo.EvalOption{indigo.Hit(indigo.HitCollect), indigo.Aggregate(indigo.CollectMax)}, int64(5)},
+		{[]indigo.EvalOption{indigo.Hit(indigo.HitCollect), indigo.Aggregate(indigo.CollectCount)}, int64(3)},
+	}
+
+	for _, c := range cases {
+		u, err := e.Eval(context.Background(), r, map[string]interface{}{}, c.opts...)
+		is.NoErr(err)
+		is.True(u.Pass)
+		is.Equal(u.Value, c.want)
+	}
+
+	// FIRST stops at the first match
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{}, indigo.Hit(indigo.HitFirst))
+	is.NoErr(err)
+	is.Equal(len(u.Results), 1)
+
+	// UNIQUE and ANY fail with more than one (different) match
+	_, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.Hit(indigo.HitUnique))
+	is.True(err != nil)
+	_, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.Hit(indigo.HitAny))
+	is.True(err != nil)
+
+	// ANY succeeds when the matching values agree
+	r.Rules["c1"].Output = int64(5)
+	r.Rules["c4"].Output = int64(5)
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.Hit(indigo.HitAny))
+	is.NoErr(err)
+	is.Equal(u.Value, int64(5))
+
+	// UNIQUE with a single match
+	r.Rules["c1"].Expr = "false"
+	r.Rules["c4"].Expr = "false"
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.Hit(indigo.HitUnique))
+	is.NoErr(err)
+	is.Equal(u.Value, int64(5))
+}
+
+func TestHitPolicyNoMatch(t *testing.T) {
+	is := is.New(t)
+	e := indigo.NewEngine(newMockEvaluator())
+
+	r := indigo.NewRule("root", "true")
+	r.EvalOptions.HitPolicy = indigo.HitCollect
+	r.EvalOptions.Aggregation = indigo.CollectSum
+	is.NoErr(r.AddChild(indigo.NewRule("c1", "false")))
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	is.True(!u.Pass)
+	is.True(u.ExpressionPass)
+	is.Equal(u.Value, int64(0))
+
+	// values must be numbers to be summed
+	r.Rules["c1"].Expr = "true"
+	_, err = e.Eval(context.Background(), r, map[string]interface{}{})
+	is.True(err != nil)
+}
+
+// With the CEL evaluator, child rules that compute values do not match;
+// only those whose conditions are true do
+func TestHitPolicyCEL(t *testing.T) {
+	is := is.New(t)
+
+	schema := indigo.Schema{Elements: []indigo.DataElement{{Name: "total", Type: indigo.Float{}}}}
+	r := &indigo.Rule{ID: "discount", Schema: schema}
+	for _, c := range []*indigo.Rule{
+		{ID: "computed", Expr: `total * 0.01`, ResultType: indigo.Float{}},
+		{ID: "small", Expr: `total < 100.0`, Output: 0.0},
+		{ID: "large", Expr: `total >= 100.0`, Output: 0.1},
+		{ID: "huge", Expr: `total >= 1000.0`, Output: 0.2},
+	} {
+		is.NoErr(r.AddChild(c))
+	}
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(r))
+
+	cases := []struct {
+		opts []indigo.EvalOption
+		want interface{}
+	}{
+		{[]indigo.EvalOption{indigo.Hit(indigo.HitUnique)}, 0.1},
+		{[]indigo.EvalOption{indigo.Hit(indigo.HitFirst)}, 0.1},
+		{[]indigo.EvalOption{indigo.Hit(indigo.HitCollect)}, []interface{}{0.1}},
+		{[]indigo.EvalOption{indigo.Hit(indigo.HitCollect), indigo.Aggregate(indigo.CollectCount)}, int64(1)},
+	}
+	for _, c := range cases {
+		u, err := e.Eval(context.Background(), r, map[string]interface{}{"total": 150.0}, c.opts...)
+		is.NoErr(err)
+		is.True(u.Pass)
+		is.Equal(u.Value, c.want)
+	}
+
+	// two conditions are true
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{"total": 1500.0},
+		indigo.Hit(indigo.HitCollect), indigo.Aggregate(indigo.CollectMax))
+	is.NoErr(err)
+	is.Equal(u.Value, 0.2)
+
+	_, err = e.Eval(context.Background(), r, map[string]interface{}{"total": 1500.0}, indigo.Hit(indigo.HitUnique))
+	is.True(err != nil)
+}
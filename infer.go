@@ -0,0 +1,289 @@
+package indigo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Inference is the outcome of forward-chaining inference with Infer.
+type Inference struct {
+	// The working data at the end of inference: the input data, with the
+	// facts produced by the rules that fired merged in.
+	Data map[string]interface{}
+
+	// The rules that fired, in the order they fired
+	Trace []Firing
+
+	// The number of cycles run, including the final cycle in which no rule fired
+	Cycles int
+
+	// Whether inference stopped because no more rules could fire (a fixpoint),
+	// rather than because the cycle limit was reached.
+	Converged bool
+
+	// The result of evaluating the rule tree against the final working data
+	Result *Result
+}
+
+// Firing records a rule that fired during inference.
+type Firing struct {
+	// The cycle in which the rule fired, starting at 1
+	Cycle int
+
+	// The ID of the rule that fired
+	RuleID string
+
+	// The value the rule produced
+	Value interface{}
+
+	// The names of the data elements the rule's value added or changed, sorted
+	Facts []string
+}
+
+// Infer performs forward-chaining inference with the child rules of r.
+//
+// Each child rule of r is a production: if it passes, its Value holds facts
+// to add to the working data, which starts out as a copy of d. A value that is
+// a map[string]interface{} is merged into the working data, setting a data
+// element for each key in the map. A value that is a protocol buffer message
+// is merged (see proto.Merge) into the data element of the same message type
+// in the rule's schema, or the schema of r.
+//
+// Inference runs in cycles. In each cycle, the child rules (the agenda) are
+// evaluated in order of their Priority, highest first, with ties broken by
+// rule ID. The first rule that passes and whose value changes the working
+// data fires: its facts are merged into the working data, and the next cycle
+// begins. Rules whose values would not change the working data do not fire,
+// so a rule fires again only when its output changes. Inference stops when no
+// rule fires (a fixpoint), or after maxCycles cycles.
+//
+// The data element names set by the rules must be in the schemas of the rules
+// that use them. The rule must be compiled.
+//
+// Evaluation options are passed to each evaluation, but the options with
+// side effects apply only to the final evaluation of the whole rule tree,
+// against the working data at the end of inference (see Inference.Result):
+// only that evaluation records a decision and runs actions, and if any action
+// fails, Infer returns the Inference along with an *ActionError. With the
+// Provider option, each data element is resolved at most once for the whole
+// inference, and the resolved values are included in the working data; with
+// ValidateInput, the input data is validated before the first cycle.
+func (e *DefaultEngine) Infer(ctx context.Context, r *Rule, d map[string]interface{},
+	maxCycles int, opts ...EvalOption) (*Inference, error) {
+
+	// Elements missing from the data are resolved by the provider when used,
+	// by whichever evaluation uses them first
+	o := EvalOptions{}
+	applyEvaluatorOptions(&o, opts...)
+	if o.provider != nil && r != nil {
+		d = lazyData(ctx, r, d, o.provider)
+	}
+
+	if err := validateEvalArguments(r, e, d); err != nil {
+		return nil, err
+	}
+	if maxCycles < 1 {
+		return nil, fmt.Errorf("rule %s: the cycle limit must be at least 1", r.ID)
+	}
+	if o.validateInput {
+		if err := validateInput(r, d); err != nil {
+			return nil, err
+		}
+	}
+
+	// The agenda is evaluated without side effects
+	agendaOpts := append(append([]EvalOption{}, opts...),
+		RecordDecisions(nil), RunActions(nil), Provider(nil), ValidateInput(false))
+
+	agenda := r.orderedChildren()
+	sort.SliceStable(agenda, func(i, j int) bool {
+		return SortRulesPriority(agenda, i, j)
+	})
+
+	inf := &Inference{
+		Data: make(map[string]interface{}, len(d)),
+	}
+	for k, v := range d {
+		inf.Data[k] = v
+	}
+
+	for inf.Cycles < maxCycles {
+		inf.Cycles++
+		fired, err := e.inferCycle(ctx, r, agenda, inf, agendaOpts...)
+		if err != nil {
+			return nil, err
+		}
+		if !fired {
+			inf.Converged = true
+			break
+		}
+	}
+
+	u, err := e.Eval(ctx, r, inf.Data, opts...)
+	if u == nil {
+		return nil, err
+	}
+	inf.Result = u
+	inf.Data = resolvedData(inf.Data)
+
+	// actions that failed are reported along with the inference
+	return inf, err
+}
+
+// inferCycle evaluates the rules on the agenda until one fires, reporting
+// whether one did.
+func (e *DefaultEngine) inferCycle(ctx context.Context, r *Rule, agenda []*Rule, inf *Inference, opts ...EvalOption) (bool, error) {
+	// the working data does not change until a rule fires, so the rules can
+	// share the results of the rules they depend on
+	s := &evalState{}
+	for _, cr := range agenda {
+		u, err := e.eval(ctx, cr, inf.Data, s, opts...)
+		if err != nil {
+			return false, err
+		}
+		if !u.Pass || u.Value == nil {
+			continue
+		}
+
+		value := nativeValue(u.Value)
+		facts, err := mergeFacts(inf.Data, value, cr, r)
+		if err != nil {
+			return false, fmt.Errorf("rule %s: %w", cr.ID, err)
+		}
+		if len(facts) == 0 {
+			continue
+		}
+
+		inf.Trace = append(inf.Trace, Firing{
+			Cycle:  inf.Cycles,
+			RuleID: cr.ID,
+			Value:  value,
+			Facts:  facts,
+		})
+		return true, nil
+	}
+	return false, nil
+}
+
+// mergeFacts merges the value produced by rule cr into the data, returning the
+// names of the data elements that changed. The value must have been converted
+// with nativeValue. Values other than maps and protocol buffer messages do not
+// change the data.
+func mergeFacts(d map[string]interface{}, v interface{}, cr, parent *Rule) ([]string, error) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		facts := []string{}
+		for k, nv := range x {
+			if ov, ok := d[k]; ok && valuesEqual(ov, nv) {
+				continue
+			}
+			d[k] = nv
+			facts = append(facts, k)
+		}
+		sort.Strings(facts)
+		return facts, nil
+
+	case proto.Message:
+		name := protoElement(x, cr.EffectiveSchema())
+		if name == "" {
+			name = protoElement(x, parent.EffectiveSchema())
+		}
+		if name == "" {
+			return nil, fmt.Errorf("no data element of type %s in the schema", x.ProtoReflect().Descriptor().FullName())
+		}
+
+		merged := proto.Clone(x)
+		if old, ok := d[name].(proto.Message); ok && old != nil {
+			merged = proto.Clone(old)
+			proto.Merge(merged, x)
+			if proto.Equal(merged, old) {
+				return nil, nil
+			}
+		}
+		d[name] = merged
+		return []string{name}, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+// valuer is implemented by the values some evaluators wrap the elements of
+// the maps and lists they construct in, such as CEL's ref.Val.
+type valuer interface {
+	Value() interface{}
+}
+
+var valuerType = reflect.TypeOf((*valuer)(nil)).Elem()
+
+// nativeValue converts a map or list whose keys or elements are valuers to
+// a Go map or slice of their values, recursively. Maps with string keys are
+// converted to map[string]interface{}, other maps to
+// map[interface{}]interface{}, and lists to []interface{}. Other values are
+// returned as they are.
+func nativeValue(v interface{}) interface{} {
+	if x, ok := v.(valuer); ok {
+		v = x.Value()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		if !rv.Type().Key().Implements(valuerType) && !rv.Type().Elem().Implements(valuerType) {
+			return v
+		}
+		keys := make([]interface{}, 0, rv.Len())
+		values := make([]interface{}, 0, rv.Len())
+		stringKeys := true
+		for _, k := range rv.MapKeys() {
+			nk := nativeValue(k.Interface())
+			if _, ok := nk.(string); !ok {
+				stringKeys = false
+			}
+			keys = append(keys, nk)
+			values = append(values, nativeValue(rv.MapIndex(k).Interface()))
+		}
+		if stringKeys {
+			m := make(map[string]interface{}, len(keys))
+			for i, k := range keys {
+				m[k.(string)] = values[i]
+			}
+			return m
+		}
+		m := make(map[interface{}]interface{}, len(keys))
+		for i, k := range keys {
+			m[k] = values[i]
+		}
+		return m
+	case reflect.Slice:
+		if !rv.Type().Elem().Implements(valuerType) {
+			return v
+		}
+		l := make([]interface{}, rv.Len())
+		for i := range l {
+			l[i] = nativeValue(rv.Index(i).Interface())
+		}
+		return l
+	}
+	return v
+}
+
+// protoElement returns the name of the data element in the schema whose type
+// is the message's type, or a blank string if there is none.
+func protoElement(m proto.Message, s Schema) string {
+	want := m.ProtoReflect().Descriptor().FullName()
+	for _, e := range s.Elements {
+		p, ok := e.Type.(Proto)
+		if !ok {
+			continue
+		}
+		if n, err := p.ProtoFullName(); err == nil && n == string(want) {
+			return e.Name
+		}
+	}
+	return ""
+}
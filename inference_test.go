@@ -0,0 +1,222 @@
+package indigo_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/ezachrisen/indigo/testdata/school"
+	"github.com/matryer/is"
+)
+
+func makeTriageRule() *indigo.Rule {
+	schema := indigo.Schema{
+		ID: "patient",
+		Elements: []indigo.DataElement{
+			{Name: "temperature", Type: indigo.Float{}},
+			{Name: "fever", Type: indigo.Bool{}},
+			{Name: "level", Type: indigo.String{}},
+		},
+	}
+
+	r := &indigo.Rule{ID: "triage", Schema: schema}
+	for _, c := range []*indigo.Rule{
+		{
+			ID:     "fever",
+			Schema: schema,
+			Expr:   `temperature > 38.0`,
+			Output: map[string]interface{}{"fever": true},
+		},
+		{
+			ID:         "urgent",
+			Schema:     schema,
+			Expr:       `fever && temperature > 40.0 ? {"level": "urgent"} : {}`,
+			ResultType: indigo.Map{KeyType: indigo.String{}, ValueType: indigo.String{}},
+			Priority:   10,
+		},
+		{
+			ID:         "routine",
+			Schema:     schema,
+			Expr:       `fever && level == "" ? {"level": "routine"} : {}`,
+			ResultType: indigo.Map{KeyType: indigo.String{}, ValueType: indigo.String{}},
+		},
+	} {
+		_ = r.AddChild(c)
+	}
+	return r
+}
+
+func TestInfer(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	r := makeTriageRule()
+	is.NoErr(e.Compile(r))
+
+	inf, err := e.Infer(context.Background(), r, map[string]interface{}{
+		"temperature": 41.0,
+		"fever":       false,
+		"level":       "",
+	}, 10)
+	is.NoErr(err)
+	is.True(inf.Converged)
+
+	// urgent has the highest priority, but only fires once fever is known;
+	// routine never fires, since urgent fires first and the level is then set
+	is.Equal(len(inf.Trace), 2)
+	is.Equal(inf.Trace[0].RuleID, "fever")
+	is.Equal(inf.Trace[0].Cycle, 1)
+	is.Equal(inf.Trace[0].Facts, []string{"fever"})
+	is.Equal(inf.Trace[1].RuleID, "urgent")
+	is.Equal(inf.Trace[1].Cycle, 2)
+	is.Equal(inf.Trace[1].Facts, []string{"level"})
+	is.Equal(inf.Cycles, 3)
+
+	is.Equal(inf.Data["fever"], true)
+	is.Equal(inf.Data["level"], "urgent")
+	is.True(inf.Result.Results["fever"].Pass)
+
+	inf, err = e.Infer(context.Background(), r, map[string]interface{}{
+		"temperature": 36.5,
+		"fever":       false,
+		"level":       "",
+	}, 10)
+	is.NoErr(err)
+	is.True(inf.Converged)
+	is.Equal(len(inf.Trace), 0)
+	is.Equal(inf.Cycles, 1)
+}
+
+func TestInferCycleLimit(t *testing.T) {
+	is := is.New(t)
+
+	schema := indigo.Schema{
+		ID:       "counter",
+		Elements: []indigo.DataElement{{Name: "n", Type: indigo.Int{}}},
+	}
+	r := &indigo.Rule{ID: "count", Schema: schema}
+	_ = r.AddChild(&indigo.Rule{ID: "inc", Schema: schema, Expr: `{"n": n + 1}`,
+		ResultType: indigo.Map{KeyType: indigo.String{}, ValueType: indigo.Int{}}})
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(r))
+
+	d := map[string]interface{}{"n": 0}
+	inf, err := e.Infer(context.Background(), r, d, 5)
+	is.NoErr(err)
+	is.True(!inf.Converged)
+	is.Equal(inf.Cycles, 5)
+	is.Equal(len(inf.Trace), 5)
+	is.Equal(inf.Data["n"], int64(5))
+	is.Equal(d["n"], 0) // the input data is not changed
+
+	_, err = e.Infer(context.Background(), r, d, 0)
+	is.True(err != nil)
+}
+
+// Maps and lists constructed in CEL expressions are converted to Go values
+// before they are merged into the data
+func TestInferCollections(t *testing.T) {
+	is := is.New(t)
+
+	schema := indigo.Schema{
+		ID:       "tagging",
+		Elements: []indigo.DataElement{{Name: "tags", Type: indigo.List{ValueType: indigo.String{}}}},
+	}
+	r := &indigo.Rule{ID: "tagging", Schema: schema}
+	_ = r.AddChild(&indigo.Rule{
+		ID:         "tag",
+		Schema:     schema,
+		Expr:       `size(tags) == 0 ? {"tags": ["a", "b"], "codes": {1: "x"}, "limits": {"max": 3}} : {}`,
+		ResultType: indigo.Map{KeyType: indigo.String{}, ValueType: indigo.Any{}},
+	})
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(r))
+
+	inf, err := e.Infer(context.Background(), r, map[string]interface{}{"tags": []string{}}, 10)
+	is.NoErr(err)
+	is.True(inf.Converged)
+	is.Equal(len(inf.Trace), 1)
+	is.Equal(inf.Trace[0].Facts, []string{"codes", "limits", "tags"})
+
+	is.Equal(inf.Data["tags"], []interface{}{"a", "b"})
+	is.Equal(inf.Data["codes"], map[interface{}]interface{}{int64(1): "x"})
+	is.Equal(inf.Data["limits"], map[string]interface{}{"max": int64(3)})
+
+	v, ok := inf.Trace[0].Value.(map[string]interface{})
+	is.True(ok)
+	is.Equal(v["tags"], []interface{}{"a", "b"})
+}
+
+func TestInferProto(t *testing.T) {
+	is := is.New(t)
+
+	schema := indigo.Schema{
+		ID:       "student",
+		Elements: []indigo.DataElement{{Name: "student", Type: indigo.Proto{Message: &school.Student{}}}},
+	}
+	r := &indigo.Rule{ID: "standing", Schema: schema}
+	_ = r.AddChild(&indigo.Rule{
+		ID:         "probation",
+		Schema:     schema,
+		Expr:       `student.gpa < 2.0 ? testdata.school.Student{status: testdata.school.Student.status_type.PROBATION} : testdata.school.Student{}`,
+		ResultType: indigo.Proto{Message: &school.Student{}},
+	})
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(r))
+
+	s := &school.Student{Id: 1, Gpa: 1.5, Credits: 12}
+	inf, err := e.Infer(context.Background(), r, map[string]interface{}{"student": s}, 10)
+	is.NoErr(err)
+	is.True(inf.Converged)
+	is.Equal(len(inf.Trace), 1)
+	is.Equal(inf.Trace[0].Facts, []string{"student"})
+
+	got := inf.Data["student"].(*school.Student)
+	is.Equal(got.Status, school.Student_PROBATION)
+	is.Equal(got.Credits, int32(12))            // merged, not replaced
+	is.Equal(s.Status, school.Student_ENROLLED) // the input is not changed
+}
+
+func TestInferSideEffects(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	r := makeTriageRule()
+	r.Rules["fever"].OnPass = []string{"notify"}
+	is.NoErr(e.Compile(r))
+
+	notified := 0
+	reg := indigo.NewActionRegistry()
+	is.NoErr(reg.Register("notify", indigo.ActionFunc(func(context.Context, *indigo.Result, map[string]interface{}) error {
+		notified++
+		return nil
+	})))
+
+	resolved := 0
+	p := indigo.DataProviderFunc(func(_ context.Context, name string) (interface{}, bool, error) {
+		resolved++
+		return 41.0, name == "temperature", nil
+	})
+
+	buf := bytes.Buffer{}
+	inf, err := e.Infer(context.Background(), r, map[string]interface{}{"fever": false, "level": ""}, 10,
+		indigo.RunActions(reg), indigo.RecordDecisions(indigo.NewJSONLinesSink(&buf)), indigo.Provider(p))
+	is.NoErr(err)
+	is.Equal(inf.Cycles, 3)
+
+	// the actions run, and the decision is recorded, for the final evaluation only
+	is.Equal(notified, 1)
+	decisions, err := indigo.ReadDecisions(&buf)
+	is.NoErr(err)
+	is.Equal(len(decisions), 1)
+	is.Equal(string(decisions[0].Data["level"]), `"urgent"`)
+
+	// the temperature is resolved once, and kept in the working data
+	is.Equal(resolved, 1)
+	is.Equal(inf.Data["temperature"], 41.0)
+}
@@ -0,0 +1,233 @@
+package indigo
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// RegisterDescriptors registers the files in the descriptor set, and the
+// message types they define, in the global protocol buffer registries, so
+// that the types can be used in schemas (see ParseType) without importing
+// the generated Go code. Files that are already registered, for example
+// because their Go code is imported, are skipped. The files must be in
+// dependency order, as produced by protoc --include_imports.
+//
+// Messages are registered as dynamic messages (see dynamicpb); input data
+// for the rules must use dynamic messages of the same types.
+func RegisterDescriptors(set *descriptorpb.FileDescriptorSet) error {
+	if set == nil {
+		return fmt.Errorf("descriptor set is nil")
+	}
+
+	for _, fdp := range set.GetFile() {
+		if _, err := protoregistry.GlobalFiles.FindFileByPath(fdp.GetName()); err == nil {
+			continue
+		}
+
+		fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+		if err != nil {
+			return fmt.Errorf("file %s: %w", fdp.GetName(), err)
+		}
+		if err := registerFile(fd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerFile registers the file and its message types, including nested
+// messages.
+func registerFile(fd protoreflect.FileDescriptor) error {
+	if err := protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+		return fmt.Errorf("file %s: %w", fd.Path(), err)
+	}
+
+	var register func(mds protoreflect.MessageDescriptors) error
+	register = func(mds protoreflect.MessageDescriptors) error {
+		for i := 0; i < mds.Len(); i++ {
+			md := mds.Get(i)
+			if md.IsMapEntry() {
+				continue
+			}
+			if _, err := protoregistry.GlobalTypes.FindMessageByName(md.FullName()); err == nil {
+				continue
+			}
+			if err := protoregistry.GlobalTypes.RegisterMessage(dynamicpb.NewMessageType(md)); err != nil {
+				return fmt.Errorf("message %s: %w", md.FullName(), err)
+			}
+			if err := register(md.Messages()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return register(fd.Messages())
+}
+
+// SchemaFromDescriptors registers the types in the descriptor set (see
+// RegisterDescriptors), and returns a schema with one element for each
+// top-level message defined in the set's files that are not imported by
+// other files in the set; for a set produced by protoc --include_imports,
+// these are the files protoc was asked to compile. The element is named after
+// the message in snake case (StudentSummary becomes student_summary), and its
+// type is a Proto of the message.
+func SchemaFromDescriptors(set *descriptorpb.FileDescriptorSet) (Schema, error) {
+	if err := RegisterDescriptors(set); err != nil {
+		return Schema{}, err
+	}
+
+	imported := map[string]bool{}
+	for _, fdp := range set.GetFile() {
+		for _, dep := range fdp.GetDependency() {
+			imported[dep] = true
+		}
+	}
+
+	s := Schema{}
+	names := map[string]protoreflect.FullName{}
+	for _, fdp := range set.GetFile() {
+		if imported[fdp.GetName()] {
+			continue
+		}
+		fd, err := protoregistry.GlobalFiles.FindFileByPath(fdp.GetName())
+		if err != nil {
+			return Schema{}, fmt.Errorf("file %s: %w", fdp.GetName(), err)
+		}
+
+		mds := fd.Messages()
+		for i := 0; i < mds.Len(); i++ {
+			md := mds.Get(i)
+			name := snakeCase(string(md.Name()))
+			if other, ok := names[name]; ok {
+				return Schema{}, fmt.Errorf("messages %s and %s have the same element name %s", other, md.FullName(), name)
+			}
+			names[name] = md.FullName()
+			s.Elements = append(s.Elements, DataElement{Name: name, Type: Proto{Message: newMessage(md)}})
+		}
+	}
+	return s, nil
+}
+
+// SchemaFromMessage returns a schema with an element for each top-level
+// field of the message, named after the field as written in the .proto file.
+// If the message's file is not registered in the global protocol buffer
+// registries, it is registered. The schema's ID is the message's full name.
+//
+// The field types map to Indigo types as follows: bool to Bool, integers and
+// enums to Int, float and double to Float, string to String, bytes to Any,
+// google.protobuf.Timestamp to Timestamp, google.protobuf.Duration to
+// Duration, other messages to Proto, and repeated and map fields to Lists and
+// Maps. Input values for unsigned integer fields must be provided as int64.
+func SchemaFromMessage(md protoreflect.MessageDescriptor) (Schema, error) {
+	if md == nil {
+		return Schema{}, fmt.Errorf("message descriptor is nil")
+	}
+
+	fd := md.ParentFile()
+	if _, err := protoregistry.GlobalFiles.FindFileByPath(fd.Path()); err != nil {
+		if err := registerFile(fd); err != nil {
+			return Schema{}, err
+		}
+	}
+
+	s := Schema{ID: string(md.FullName())}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		f := fields.Get(i)
+		typ, err := fieldType(f)
+		if err != nil {
+			return Schema{}, fmt.Errorf("message %s: field %s: %w", md.FullName(), f.Name(), err)
+		}
+		s.Elements = append(s.Elements, DataElement{Name: string(f.Name()), Type: typ})
+	}
+	return s, nil
+}
+
+// fieldType returns the Indigo type of the field.
+func fieldType(f protoreflect.FieldDescriptor) (Type, error) {
+	switch {
+	case f.IsMap():
+		k, err := kindType(f.MapKey())
+		if err != nil {
+			return nil, err
+		}
+		v, err := kindType(f.MapValue())
+		if err != nil {
+			return nil, err
+		}
+		return Map{KeyType: k, ValueType: v}, nil
+	case f.IsList():
+		v, err := kindType(f)
+		if err != nil {
+			return nil, err
+		}
+		return List{ValueType: v}, nil
+	}
+	return kindType(f)
+}
+
+// kindType returns the Indigo type of a single value of the field, ignoring
+// whether it is repeated.
+func kindType(f protoreflect.FieldDescriptor) (Type, error) {
+	switch f.Kind() {
+	case protoreflect.BoolKind:
+		return Bool{}, nil
+	case protoreflect.EnumKind,
+		protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return Int{}, nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return Float{}, nil
+	case protoreflect.StringKind:
+		return String{}, nil
+	case protoreflect.BytesKind:
+		return Any{}, nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		md := f.Message()
+		switch md.FullName() {
+		case "google.protobuf.Timestamp":
+			return Timestamp{}, nil
+		case "google.protobuf.Duration":
+			return Duration{}, nil
+		}
+		return Proto{Message: newMessage(md)}, nil
+	}
+	return nil, fmt.Errorf("unsupported kind %v", f.Kind())
+}
+
+// newMessage returns an empty message of the type registered for the
+// descriptor, or a dynamic message if the type is not registered.
+func newMessage(md protoreflect.MessageDescriptor) proto.Message {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(md.FullName()); err == nil {
+		return mt.New().Interface()
+	}
+	return dynamicpb.NewMessage(md)
+}
+
+// snakeCase converts a CamelCase name to snake_case.
+func snakeCase(s string) string {
+	b := strings.Builder{}
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// start a new word before an upper-case letter that follows a
+			// lower-case letter, or that starts a word after an acronym
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
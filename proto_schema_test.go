@@ -0,0 +1,145 @@
+package indigo_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/ezachrisen/indigo/testdata/school"
+	"github.com/matryer/is"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func elementStrings(s indigo.Schema) []string {
+	l := []string{}
+	for _, e := range s.Elements {
+		l = append(l, e.String())
+	}
+	return l
+}
+
+func TestSchemaFromMessage(t *testing.T) {
+	is := is.New(t)
+
+	s, err := indigo.SchemaFromMessage((&school.Student{}).ProtoReflect().Descriptor())
+	is.NoErr(err)
+	is.Equal(s.ID, "testdata.school.Student")
+	is.Equal(elementStrings(s), []string{
+		"  id (float)",
+		"  age (int)",
+		"  credits (int)",
+		"  gpa (float)",
+		"  status (int)",
+		"  enrollment_date (timestamp)",
+		"  off_campus (proto(testdata.school.Student.Address))",
+		"  on_campus (proto(testdata.school.Student.CampusAddress))",
+		"  attrs (map[string]string)",
+		"  grades ([]float)",
+		"  suspensions ([]proto(testdata.school.Student.Suspension))",
+	})
+
+	r := &indigo.Rule{
+		ID:     "honors",
+		Schema: s,
+		Expr:   `gpa >= 3.5 && grades.all(g, g > 3.0) && off_campus.city == "Boston"`,
+	}
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{
+		"gpa":        3.8,
+		"grades":     []float64{3.5, 4.0},
+		"off_campus": &school.Student_Address{City: "Boston"},
+	})
+	is.NoErr(err)
+	is.True(u.Pass)
+}
+
+func TestSchemaFromDescriptors(t *testing.T) {
+	is := is.New(t)
+
+	b, err := os.ReadFile("testdata/school.descriptor")
+	is.NoErr(err)
+	set := &descriptorpb.FileDescriptorSet{}
+	is.NoErr(proto.Unmarshal(b, set))
+
+	// the files are already registered by the generated code
+	s, err := indigo.SchemaFromDescriptors(set)
+	is.NoErr(err)
+	is.Equal(elementStrings(s), []string{
+		"  honors_configuration (proto(testdata.school.HonorsConfiguration))",
+		"  student (proto(testdata.school.Student))",
+		"  student_summary (proto(testdata.school.StudentSummary))",
+	})
+	_, ok := s.Elements[1].Type.(indigo.Proto).Message.(*school.Student)
+	is.True(ok)
+}
+
+func TestRegisterDescriptors(t *testing.T) {
+	is := is.New(t)
+
+	// a file that is only available as a descriptor
+	order := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("dynamic/order.proto"),
+		Package:    proto.String("testdata.dynamic"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("WebOrder"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{Name: proto.String("total"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_DOUBLE.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), JsonName: proto.String("total")},
+					{Name: proto.String("placed"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(".google.protobuf.Timestamp"), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), JsonName: proto.String("placed")},
+					{Name: proto.String("skus"), Number: proto.Int32(3), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(), JsonName: proto.String("skus")},
+				},
+			},
+		},
+	}
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(timestamppb.File_google_protobuf_timestamp_proto),
+			order,
+		},
+	}
+
+	s, err := indigo.SchemaFromDescriptors(set)
+	is.NoErr(err)
+	is.Equal(elementStrings(s), []string{"  web_order (proto(testdata.dynamic.WebOrder))"})
+
+	// the message can be found by name once registered
+	typ, err := indigo.ParseType("proto(testdata.dynamic.WebOrder)")
+	is.NoErr(err)
+	is.Equal(typ.String(), "proto(testdata.dynamic.WebOrder)")
+
+	// registering again is a no-op
+	is.NoErr(indigo.RegisterDescriptors(set))
+
+	// rules can be evaluated with dynamic messages
+	mt, err := protoregistry.GlobalTypes.FindMessageByName("testdata.dynamic.WebOrder")
+	is.NoErr(err)
+	m := dynamicpb.NewMessage(mt.Descriptor())
+	m.Set(mt.Descriptor().Fields().ByName("total"), protoreflect.ValueOfFloat64(120.0))
+
+	r := &indigo.Rule{
+		ID:     "big_order",
+		Schema: s,
+		Expr:   `web_order.total > 100.0 && size(web_order.skus) == 0`,
+	}
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(r))
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{"web_order": m})
+	is.NoErr(err)
+	is.True(u.Pass)
+
+	ms, err := indigo.SchemaFromMessage(mt.Descriptor())
+	is.NoErr(err)
+	is.Equal(elementStrings(ms), []string{"  total (float)", "  placed (timestamp)", "  skus ([]string)"})
+}
@@ -0,0 +1,130 @@
+package indigo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DataProvider is the interface that wraps the Resolve method.
+// Resolve returns the value of the data element with the name, for example
+// by calling the service that owns the data. It returns false if there is
+// no value for the element; the expressions that use the element then fail,
+// as if the element were missing from the input data.
+//
+// Resolve is called with the context passed to Eval, and should return when
+// the context is canceled.
+type DataProvider interface {
+	Resolve(ctx context.Context, name string) (interface{}, bool, error)
+}
+
+// DataProviderFunc is an adapter to allow the use of an ordinary function as
+// a DataProvider.
+type DataProviderFunc func(ctx context.Context, name string) (interface{}, bool, error)
+
+// Resolve calls f(ctx, name).
+func (f DataProviderFunc) Resolve(ctx context.Context, name string) (interface{}, bool, error) {
+	return f(ctx, name)
+}
+
+// LazyValue is the value of a data element, resolved by a DataProvider the
+// first time it is needed. When the Provider option is set, Eval passes a
+// *LazyValue in the data map to the evaluator for each element declared in
+// the rules' schemas that is missing from the input data. Evaluators call
+// Value to resolve the element; the CEL evaluator does so only when an
+// expression uses the element.
+//
+// The value is resolved at most once, and the outcome is kept for the rest
+// of the evaluation. A LazyValue is safe for concurrent use.
+type LazyValue struct {
+	ctx      context.Context
+	name     string
+	provider DataProvider
+
+	mu    sync.Mutex
+	done  bool
+	value interface{}
+	ok    bool
+	err   error
+}
+
+// Name returns the name of the data element.
+func (v *LazyValue) Name() string {
+	return v.name
+}
+
+// Value resolves the data element, returning its value, or false if the
+// provider has no value for it.
+func (v *LazyValue) Value() (interface{}, bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.done {
+		if err := v.ctx.Err(); err != nil {
+			// not cached, so that a canceled evaluation is not mistaken for
+			// a failed lookup
+			return nil, false, fmt.Errorf("resolving data element %s: %w", v.name, err)
+		}
+		v.value, v.ok, v.err = v.provider.Resolve(v.ctx, v.name)
+		if v.err != nil {
+			v.err = fmt.Errorf("resolving data element %s: %w", v.name, v.err)
+		}
+		v.done = true
+	}
+	return v.value, v.ok, v.err
+}
+
+// resolved returns the value, if it has been resolved.
+func (v *LazyValue) resolved() (interface{}, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.value, v.done && v.ok && v.err == nil
+}
+
+// lazyData returns a copy of the data, with a LazyValue for each element
+// declared in the schemas of the rule and its descendants that is missing
+// from the data.
+func lazyData(ctx context.Context, r *Rule, d map[string]interface{}, p DataProvider) map[string]interface{} {
+	data := make(map[string]interface{}, len(d))
+	for k, v := range d {
+		data[k] = v
+	}
+
+	_ = ApplyToRule(r, func(r *Rule) error {
+		for _, e := range r.EffectiveSchema().Elements {
+			if _, ok := data[e.Name]; ok || e.Name == selfKey || e.Name == RulesKey {
+				continue
+			}
+			data[e.Name] = &LazyValue{ctx: ctx, name: e.Name, provider: p}
+		}
+		return nil
+	})
+	return data
+}
+
+// resolvedData returns a copy of the data with each LazyValue replaced by its
+// value if it has been resolved, and left out if it has not. Data without
+// LazyValues is returned as it is.
+func resolvedData(d map[string]interface{}) map[string]interface{} {
+	lazy := false
+	for _, v := range d {
+		if _, ok := v.(*LazyValue); ok {
+			lazy = true
+			break
+		}
+	}
+	if !lazy {
+		return d
+	}
+
+	data := make(map[string]interface{}, len(d))
+	for k, v := range d {
+		if lv, ok := v.(*LazyValue); ok {
+			if v, ok = lv.resolved(); !ok {
+				continue
+			}
+		}
+		data[k] = v
+	}
+	return data
+}
@@ -0,0 +1,185 @@
+package indigo_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/matryer/is"
+)
+
+// countingProvider resolves data elements from a map, counting the lookups
+type countingProvider struct {
+	values map[string]interface{}
+	calls  map[string]int
+}
+
+func (p *countingProvider) Resolve(_ context.Context, name string) (interface{}, bool, error) {
+	p.calls[name]++
+	if name == "broken" {
+		return nil, false, fmt.Errorf("service unavailable")
+	}
+	v, ok := p.values[name]
+	return v, ok, nil
+}
+
+func TestDataProvider(t *testing.T) {
+	is := is.New(t)
+
+	schema := indigo.Schema{
+		Elements: []indigo.DataElement{
+			{Name: "balance", Type: indigo.Int{}},
+			{Name: "history", Type: indigo.List{ValueType: indigo.String{}}},
+			{Name: "region", Type: indigo.String{}},
+			{Name: "broken", Type: indigo.Int{}},
+		},
+	}
+
+	root := &indigo.Rule{
+		ID:     "root",
+		Schema: schema,
+		Expr:   `region == "EU"`,
+		EvalOptions: indigo.EvalOptions{
+			StopIfParentNegative: true,
+		},
+		Rules: map[string]*indigo.Rule{
+			"low":    {ID: "low", Expr: "balance < 100"},
+			"high":   {ID: "high", Expr: "balance > 1000"},
+			"recent": {ID: "recent", Expr: `balance > 0 || "late" in history`},
+		},
+	}
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(root))
+
+	p := &countingProvider{
+		values: map[string]interface{}{
+			"balance": 50,
+			"history": []string{"late"},
+			"region":  "US",
+		},
+		calls: map[string]int{},
+	}
+
+	// the children are not evaluated, so only region is resolved
+	u, err := e.Eval(context.Background(), root, nil, indigo.Provider(p))
+	is.NoErr(err)
+	is.True(!u.Pass)
+	is.Equal(p.calls, map[string]int{"region": 1})
+
+	// each element is resolved once per evaluation, and history is not needed
+	p.values["region"] = "EU"
+	p.calls = map[string]int{}
+	u, err = e.Eval(context.Background(), root, nil, indigo.Provider(p))
+	is.NoErr(err)
+	is.True(u.Results["low"].Pass)
+	is.True(!u.Results["high"].Pass)
+	is.Equal(p.calls, map[string]int{"region": 1, "balance": 1})
+
+	// elements in the input data are not resolved
+	p.calls = map[string]int{}
+	_, err = e.Eval(context.Background(), root, map[string]interface{}{"region": "EU", "balance": 5000}, indigo.Provider(p))
+	is.NoErr(err)
+	is.Equal(len(p.calls), 0)
+
+	// an element the provider has no value for is missing
+	delete(p.values, "balance")
+	_, err = e.Eval(context.Background(), root, nil, indigo.Provider(p))
+	is.True(err != nil)
+
+	// the provider's errors are returned
+	root.Rules["broken"] = &indigo.Rule{ID: "broken", Expr: "broken > 1"}
+	is.NoErr(e.Compile(root))
+	_, err = e.Eval(context.Background(), root, map[string]interface{}{"balance": 1}, indigo.Provider(p))
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "resolving data element broken: service unavailable"))
+
+	// elements are not resolved after the evaluation is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.calls = map[string]int{}
+	_, err = e.Eval(ctx, root, nil, indigo.Provider(p))
+	is.True(err != nil)
+	is.Equal(len(p.calls), 0)
+}
+
+func TestDataProviderFunc(t *testing.T) {
+	is := is.New(t)
+
+	r := &indigo.Rule{
+		ID:     "adult",
+		Schema: indigo.Schema{Elements: []indigo.DataElement{{Name: "age", Type: indigo.Int{}}}},
+		Expr:   "age >= 18",
+	}
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(r))
+
+	p := indigo.DataProviderFunc(func(_ context.Context, name string) (interface{}, bool, error) {
+		return 21, name == "age", nil
+	})
+
+	buf := bytes.Buffer{}
+	u, err := e.Eval(context.Background(), r, nil, indigo.Provider(p), indigo.RecordDecisions(indigo.NewJSONLinesSink(&buf)))
+	is.NoErr(err)
+	is.True(u.Pass)
+
+	// the resolved elements are recorded
+	decisions, err := indigo.ReadDecisions(&buf)
+	is.NoErr(err)
+	is.Equal(len(decisions), 1)
+	is.Equal(string(decisions[0].Data["age"]), "21")
+}
+
+func TestDataProviderActionsAndShadows(t *testing.T) {
+	is := is.New(t)
+
+	schema := indigo.Schema{
+		Elements: []indigo.DataElement{
+			{Name: "balance", Type: indigo.Int{}},
+			{Name: "region", Type: indigo.String{}},
+		},
+	}
+
+	primary := &indigo.Rule{ID: "low", Schema: schema, Expr: "balance < 100", OnPass: []string{"notify"}}
+	candidate := &indigo.Rule{ID: "low", Schema: schema, Expr: "balance < 10"}
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(primary))
+	is.NoErr(e.Compile(candidate))
+
+	// the action is given the resolved value, and not the element that was
+	// not used
+	var got map[string]interface{}
+	reg := indigo.NewActionRegistry()
+	is.NoErr(reg.Register("notify", indigo.ActionFunc(func(_ context.Context, _ *indigo.Result, d map[string]interface{}) error {
+		got = d
+		return nil
+	})))
+
+	p := &countingProvider{
+		values: map[string]interface{}{"balance": 50, "region": "EU"},
+		calls:  map[string]int{},
+	}
+
+	_, err := e.Eval(context.Background(), primary, nil, indigo.Provider(p), indigo.RunActions(reg))
+	is.NoErr(err)
+	is.Equal(got, map[string]interface{}{"balance": 50})
+
+	// the shadow evaluation uses the value resolved for the primary evaluation
+	p.calls = map[string]int{}
+	var reports []indigo.ShadowReport
+	s := indigo.NewShadow(e, func(r indigo.ShadowReport) { reports = append(reports, r) }, candidate)
+	u, err := s.Eval(context.Background(), primary, nil, indigo.Provider(p))
+	is.NoErr(err)
+	is.True(u.Pass)
+	s.Wait()
+
+	is.Equal(p.calls, map[string]int{"balance": 1})
+	is.Equal(len(reports), 1)
+	is.NoErr(reports[0].Err)
+	is.True(!reports[0].ShadowResult.Pass)
+}
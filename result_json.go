@@ -0,0 +1,169 @@
+package indigo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// resultJSON is the JSON representation of a Result.
+type resultJSON struct {
+	RuleID         string             `json:"rule_id"`
+	RuleVersion    string             `json:"rule_version,omitempty"`
+	RuleHash       string             `json:"rule_hash,omitempty"`
+	Pass           bool               `json:"pass"`
+	ExpressionPass bool               `json:"expression_pass"`
+	Skipped        bool               `json:"skipped,omitempty"`
+	Value          json.RawMessage    `json:"value,omitempty"`
+	Score          float64            `json:"score,omitempty"`
+	Results        map[string]*Result `json:"results,omitempty"`
+	RulesEvaluated []string           `json:"rules_evaluated,omitempty"`
+	Diagnostics    *Diagnostics       `json:"diagnostics,omitempty"`
+	DurationNanos  int64              `json:"duration_ns,omitempty"`
+	Actions        []actionRunJSON    `json:"actions,omitempty"`
+}
+
+// actionRunJSON is the JSON representation of an ActionRun.
+type actionRunJSON struct {
+	Action   string `json:"action"`
+	RuleID   string `json:"rule_id"`
+	Pass     bool   `json:"pass"`
+	Executed bool   `json:"executed"`
+	Error    string `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes the result and its children as JSON.
+//
+// The format is stable, and only includes the outcome of the evaluation,
+// not the rule definition or evaluation options:
+//
+//	{
+//	  "rule_id": "offers",             // the ID of the rule
+//	  "rule_version": "3",             // the rule's Version (omitted if blank)
+//	  "rule_hash": "4bf5...",          // the rule's content hash (omitted if blank)
+//	  "pass": true,
+//	  "expression_pass": true,
+//	  "skipped": true,                 // the rule was disabled or not in effect (omitted if false)
+//	  "value": true,                   // the expression's output value
+//	  "score": 2,                      // the roll-up score (omitted if zero)
+//	  "results": {                     // child results, by rule ID (omitted if none)
+//	    "summer": { "rule_id": "summer", ... }
+//	  },
+//	  "rules_evaluated": ["summer"],   // diagnostics only: child rules in evaluation order
+//	  "diagnostics": { ... },          // diagnostics only: see Diagnostics
+//	  "duration_ns": 12000,            // diagnostics only: evaluation time in nanoseconds
+//	  "actions": [                     // root only, with RunActions: the actions that fired
+//	    { "action": "notify", "rule_id": "summer", "pass": true, "executed": true, "error": "..." }
+//	  ]
+//	}
+//
+// Values that are protocol buffer messages are encoded with protojson;
+// other values are encoded with encoding/json.
+func (u *Result) MarshalJSON() ([]byte, error) {
+	if u == nil {
+		return []byte("null"), nil
+	}
+
+	value, err := encodeValue(u.Value)
+	if err != nil {
+		return nil, fmt.Errorf("encoding value: %w", err)
+	}
+
+	j := resultJSON{
+		RuleVersion:    u.RuleVersion,
+		RuleHash:       u.RuleHash,
+		Pass:           u.Pass,
+		ExpressionPass: u.ExpressionPass,
+		Skipped:        u.Skipped,
+		Value:          value,
+		Score:          u.Score,
+		Results:        u.Results,
+		Diagnostics:    u.Diagnostics,
+		DurationNanos:  int64(u.Duration),
+	}
+
+	if u.Rule != nil {
+		j.RuleID = u.Rule.ID
+	}
+
+	for _, r := range u.RulesEvaluated {
+		j.RulesEvaluated = append(j.RulesEvaluated, r.ID)
+	}
+
+	for _, a := range u.Actions {
+		aj := actionRunJSON{
+			Action:   a.Action,
+			RuleID:   a.RuleID,
+			Pass:     a.Pass,
+			Executed: a.Executed,
+		}
+		if a.Err != nil {
+			aj.Error = a.Err.Error()
+		}
+		j.Actions = append(j.Actions, aj)
+	}
+
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes a result encoded by MarshalJSON.
+//
+// Since the JSON representation does not include the rule definition, the
+// decoded Result's Rule (and the rules in RulesEvaluated) only have their ID
+// and Version set. The Value is decoded with encoding/json, so numbers are
+// float64 and objects, including protocol buffers, are map[string]interface{}.
+func (u *Result) UnmarshalJSON(b []byte) error {
+	j := resultJSON{}
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	var value interface{}
+	if len(j.Value) > 0 {
+		if err := json.Unmarshal(j.Value, &value); err != nil {
+			return fmt.Errorf("decoding value: %w", err)
+		}
+	}
+
+	*u = Result{
+		Rule:           &Rule{ID: j.RuleID, Version: j.RuleVersion},
+		RuleVersion:    j.RuleVersion,
+		RuleHash:       j.RuleHash,
+		Pass:           j.Pass,
+		ExpressionPass: j.ExpressionPass,
+		Skipped:        j.Skipped,
+		Value:          value,
+		Score:          j.Score,
+		Results:        j.Results,
+		Diagnostics:    j.Diagnostics,
+		Duration:       time.Duration(j.DurationNanos),
+	}
+
+	if u.Results == nil {
+		u.Results = map[string]*Result{}
+	}
+
+	for _, id := range j.RulesEvaluated {
+		r := &Rule{ID: id}
+		if c, ok := u.Results[id]; ok {
+			r = c.Rule
+		}
+		u.RulesEvaluated = append(u.RulesEvaluated, r)
+	}
+
+	for _, aj := range j.Actions {
+		a := ActionRun{
+			Action:   aj.Action,
+			RuleID:   aj.RuleID,
+			Pass:     aj.Pass,
+			Executed: aj.Executed,
+		}
+		if aj.Error != "" {
+			a.Err = errors.New(aj.Error)
+		}
+		u.Actions = append(u.Actions, a)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package indigo_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/matryer/is"
+)
+
+func TestResultJSON(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(newMockEvaluator())
+	r := makeRule()
+	r.Version = "12"
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+
+	b, err := json.Marshal(u)
+	is.NoErr(err)
+
+	// The rule definition and evaluation options are not included
+	is.True(!strings.Contains(string(b), "eval_options"))
+	is.True(!strings.Contains(string(b), `"expr"`))
+	is.True(!strings.Contains(string(b), "duration_ns"))
+
+	got := &indigo.Result{}
+	is.NoErr(json.Unmarshal(b, got))
+	is.Equal(got.Rule.ID, "rule1")
+	is.Equal(got.Rule.Version, "12")
+	is.Equal(got.RuleVersion, "12")
+	is.Equal(got.RuleHash, r.Hash())
+	is.Equal(got.Value, true)
+	is.NoErr(match(flattenResultsRuleResult(got), flattenResultsRuleResult(u)))
+	is.NoErr(match(flattenResultsExprResult(got), flattenResultsExprResult(u)))
+	is.Equal(len(got.Results["B"].Results["b4"].Results), 2)
+}
+
+func TestResultJSONDiagnostics(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(newMockEvaluator())
+	r := makeRule()
+	is.NoErr(e.Compile(r, indigo.CollectDiagnostics(true)))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{},
+		indigo.ReturnDiagnostics(true), indigo.SortFunc(indigo.SortRulesAlpha))
+	is.NoErr(err)
+	u.Diagnostics = &indigo.Diagnostics{
+		Expr:      "a",
+		Interface: 1.5,
+		Source:    indigo.Evaluated,
+		Children:  []indigo.Diagnostics{{Expr: "b", Source: indigo.Input}},
+	}
+
+	b, err := json.Marshal(u)
+	is.NoErr(err)
+	is.True(strings.Contains(string(b), `"source":"Evaluated"`))
+
+	got := &indigo.Result{}
+	is.NoErr(json.Unmarshal(b, got))
+	is.Equal(got.Diagnostics, u.Diagnostics)
+	is.Equal(got.Duration, u.Duration)
+	is.True(got.Duration > 0)
+
+	ids := []string{}
+	for _, x := range got.RulesEvaluated {
+		ids = append(ids, x.ID)
+	}
+	is.Equal(ids, []string{"B", "D", "E"})
+	is.Equal(got.RulesEvaluated[0], got.Results["B"].Rule)
+}
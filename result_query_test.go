@@ -0,0 +1,106 @@
+package indigo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/matryer/is"
+)
+
+func resultIDs(l []*indigo.Result) []string {
+	ids := []string{}
+	for _, u := range l {
+		ids = append(ids, u.Rule.ID)
+	}
+	return ids
+}
+
+func TestFlatten(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(newMockEvaluator())
+	r := makeRule()
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+
+	// Without a sort function, results are ordered by rule ID
+	is.Equal(resultIDs(u.Flatten()), []string{
+		"rule1", "B", "b1", "b2", "b3", "b4", "b4-1", "b4-2", "D", "d1", "d2", "d3", "E", "e1", "e2", "e3"})
+
+	// The sort function determines the order
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.SortFunc(indigo.SortRulesAlphaDesc))
+	is.NoErr(err)
+	is.Equal(resultIDs(u.Flatten()), []string{
+		"rule1", "E", "e3", "e2", "e1", "D", "d3", "d2", "d1", "B", "b4", "b4-2", "b4-1", "b3", "b2", "b1"})
+
+	// The order of evaluation is used if it's available
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.ReturnDiagnostics(true))
+	is.NoErr(err)
+	u.RulesEvaluated = []*indigo.Rule{r.Rules["E"], r.Rules["B"], r.Rules["D"]}
+	is.Equal(resultIDs(u.Flatten())[:6], []string{"rule1", "E", "e1", "e2", "e3", "B"})
+}
+
+// Child results follow the evaluation order, then the order the rules were
+// added, then the rule IDs
+func TestFlattenOrder(t *testing.T) {
+	is := is.New(t)
+
+	r := &indigo.Rule{ID: "root", Expr: "true"}
+	for _, id := range []string{"c", "a", "b"} {
+		is.NoErr(r.AddChild(&indigo.Rule{ID: id, Expr: "true"}))
+	}
+	r.Rules["e"] = &indigo.Rule{ID: "e", Expr: "true"}
+	r.Rules["d"] = &indigo.Rule{ID: "d", Expr: "true"}
+	is.NoErr(r.Rules["c"].AddChild(&indigo.Rule{ID: "c2", Expr: "true"}))
+	is.NoErr(r.Rules["c"].AddChild(&indigo.Rule{ID: "c1", Expr: "true"}))
+
+	e := indigo.NewEngine(newMockEvaluator())
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	is.Equal(resultIDs(u.Flatten()), []string{"root", "c", "c2", "c1", "a", "b", "d", "e"})
+
+	// RulesEvaluated comes first, the rest keep their order
+	u.RulesEvaluated = []*indigo.Rule{r.Rules["d"], r.Rules["a"]}
+	is.Equal(resultIDs(u.Flatten()), []string{"root", "d", "a", "c", "c2", "c1", "b", "e"})
+
+	// The sort function sorts the results not in RulesEvaluated
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.SortFunc(indigo.SortRulesAlpha))
+	is.NoErr(err)
+	u.RulesEvaluated = []*indigo.Rule{r.Rules["d"]}
+	is.Equal(resultIDs(u.Flatten()), []string{"root", "d", "a", "b", "c", "c1", "c2", "e"})
+}
+
+func TestFilterAndLookup(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(newMockEvaluator())
+	r := makeRule()
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+
+	is.Equal(resultIDs(u.PassingLeaves()), []string{"b1", "b3", "b4-1", "d1", "d3", "e1", "e3"})
+
+	failedExpr := u.Filter(func(c *indigo.Result) bool { return !c.ExpressionPass })
+	is.Equal(resultIDs(failedExpr), []string{"B", "b2", "b4", "b4-2", "d2", "E", "e2"})
+
+	c, ok := u.Lookup("B/b4/b4-1")
+	is.True(ok)
+	is.Equal(c.Rule.ID, "b4-1")
+
+	c, ok = u.Lookup("")
+	is.True(ok)
+	is.Equal(c, u)
+
+	_, ok = u.Lookup("B/b5")
+	is.True(!ok)
+
+	_, ok = u.Lookup("rule1/B")
+	is.True(!ok)
+}
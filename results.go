@@ -2,22 +2,35 @@ package indigo
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
 )
 
 // Result of evaluating a rule.
+//
+// A Result can be serialized to JSON; see MarshalJSON for the format.
 type Result struct {
 	// The Rule that was evaluated
 	Rule *Rule
 
+	// The version of the rule at the time of evaluation (see Rule.Version)
+	RuleVersion string
+
+	// The content hash of the rule and its children at the time the rule
+	// was compiled (see Rule.Hash)
+	RuleHash string
+
 	// Whether the rule is true.
 	// The default is TRUE.
 	// Pass is the result of rolling up all child rules and evaluating the
-	// rule's own expression. All child rules and the rule's expression must be
-	// true for Pass to be true.
+	// rule's own expression. By default, all child rules and the rule's
+	// expression must be true for Pass to be true; the TrueIfAny, RollUp and
+	// HitPolicy evaluation options change how child rules are rolled up.
 	Pass bool
 
 	// Whether evaluating the rule expression yielded a TRUE logical value.
@@ -31,12 +44,28 @@ type Result struct {
 	// This value is never affected by child rules.
 	Value interface{}
 
+	// Whether the rule was skipped because it is disabled or not in effect at
+	// the time of the evaluation (see Rule.InEffect). A skipped rule's
+	// expression and child rules are not evaluated, and Pass and ExpressionPass
+	// are false. Skipped child rules do not count as passed or failed when the
+	// parent rule's result is determined.
+	Skipped bool
+
 	// Results of evaluating the child rules.
 	Results map[string]*Result
 
+	// The score computed by the roll-up of the child rules: the sum of the
+	// weights of the child rules that passed (RollUpWeighted), or the number
+	// of child rules that passed (other roll-ups). Zero for the default roll-up.
+	Score float64
+
 	// Diagnostic data; only available if you turn on diagnostics for the evaluation
 	Diagnostics *Diagnostics
 
+	// The time taken to evaluate the rule and its children.
+	// Only available if you turn on diagnostics for the evaluation
+	Duration time.Duration
+
 	// The evaluation options used
 	EvalOptions EvalOptions
 
@@ -46,6 +75,15 @@ type Result struct {
 	// If we're discarding failed/passed rules, they will not be in the results,
 	// and will not show up in diagnostics, but they will be in this list.
 	RulesEvaluated []*Rule
+
+	// The actions that fired, in the order they were executed. Only set on
+	// the result of the root rule, and only if the RunActions option is set.
+	Actions []ActionRun
+
+	// Whether the expression returned true, as opposed to false or a value
+	// that is not a boolean. Only rules whose expression returned true match
+	// under a hit policy.
+	conditionTrue bool
 }
 
 // String produces a list of rules (including child rules) executed and the result of the evaluation.
@@ -53,7 +91,7 @@ func (u *Result) String() string {
 
 	tw := table.NewWriter()
 	tw.SetTitle("\nINDIGO RESULTS\n")
-	tw.AppendHeader(table.Row{"\nRule", "Pass/\nFail", "Expr.\nPass/\nFail", "Chil-\ndren", "Output\nValue", "Diagnostics\nAvailable?", "True\nIf Any?",
+	tw.AppendHeader(table.Row{"\nRule", "Pass/\nFail", "Expr.\nPass/\nFail", "Chil-\ndren", "Output\nValue", "Diagnostics\nAvailable?", "True\nIf Any?", "Roll Up", "Score",
 		"Stop If\nParent Neg.", "Stop First\nPos. Child", "Stop First\nNeg. Child", "Discard\nPass", "Discard\nFail"})
 	rows := u.resultsToRows(0)
 
@@ -75,6 +113,15 @@ func boolString(b bool) string {
 	}
 }
 
+// passString formats a pass/fail value of the result, or SKIP if the
+// rule was skipped.
+func passString(u *Result, b bool) string {
+	if u.Skipped {
+		return "SKIP"
+	}
+	return boolString(b)
+}
+
 // resultsToRows transforms the Results data to a list of resultsToRows
 // for inclusion in a table.Writer table.
 func (u *Result) resultsToRows(n int) []table.Row {
@@ -88,12 +135,14 @@ func (u *Result) resultsToRows(n int) []table.Row {
 
 	row := table.Row{
 		fmt.Sprintf("%s%s", indent, u.Rule.ID),
-		boolString(u.Pass),
-		boolString(u.ExpressionPass),
+		passString(u, u.Pass),
+		passString(u, u.ExpressionPass),
 		fmt.Sprintf("%d", len(u.Results)),
 		fmt.Sprintf("%v", u.Value),
 		trueFalse(fmt.Sprintf("%t", diag)),
 		trueFalse(fmt.Sprintf("%t", u.EvalOptions.TrueIfAny)),
+		rollUpString(u.EvalOptions),
+		scoreString(u),
 		trueFalse(fmt.Sprintf("%t", u.EvalOptions.StopIfParentNegative)),
 		trueFalse(fmt.Sprintf("%t", u.EvalOptions.StopFirstPositiveChild)),
 		trueFalse(fmt.Sprintf("%t", u.EvalOptions.StopFirstNegativeChild)),
@@ -102,12 +151,21 @@ func (u *Result) resultsToRows(n int) []table.Row {
 	}
 
 	rows = append(rows, row)
-	for _, cd := range u.Results {
+	for _, cd := range u.childResults() {
 		rows = append(rows, cd.resultsToRows(n+1)...)
 	}
 	return rows
 }
 
+// scoreString formats the result's score, blank if the roll-up does not
+// compute a score.
+func scoreString(u *Result) string {
+	if u.EvalOptions.RollUp == RollUpAll || len(u.Rule.Rules) == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(u.Score, 'g', -1, 64)
+}
+
 func trueFalse(t string) string {
 	switch t {
 	case "false":
@@ -144,14 +202,124 @@ func (u *Result) summaryResultsToRows(n int) []table.Row {
 
 	row := table.Row{
 		fmt.Sprintf("%s%s", indent, u.Rule.ID),
-		boolString(u.Pass),
-		boolString(u.ExpressionPass),
+		passString(u, u.Pass),
+		passString(u, u.ExpressionPass),
 		fmt.Sprintf("%v", u.Value),
 	}
 
 	rows = append(rows, row)
-	for _, cd := range u.Results {
+	for _, cd := range u.childResults() {
 		rows = append(rows, cd.summaryResultsToRows(n+1)...)
 	}
 	return rows
 }
+
+// Flatten returns the result and all of its child results, recursively, as a
+// list. Each result is followed by its children.
+//
+// Child results in RulesEvaluated (set if diagnostics were returned) come
+// first, in the order they were evaluated. The others follow in the order
+// the child rules were added (see AddChild), then those added directly to
+// the Rules map by rule ID, and the SortFunc in the evaluation options, if
+// any, sorts this remainder.
+func (u *Result) Flatten() []*Result {
+	l := []*Result{u}
+	for _, c := range u.childResults() {
+		l = append(l, c.Flatten()...)
+	}
+	return l
+}
+
+// Filter returns the results in the tree for which the function returns
+// true, in the order given by Flatten.
+func (u *Result) Filter(fn func(u *Result) bool) []*Result {
+	l := []*Result{}
+	for _, c := range u.Flatten() {
+		if fn(c) {
+			l = append(l, c)
+		}
+	}
+	return l
+}
+
+// PassingLeaves returns the results of the rules without child rules that
+// passed, in the order given by Flatten.
+func (u *Result) PassingLeaves() []*Result {
+	return u.Filter(func(c *Result) bool {
+		return c.Pass && len(c.Results) == 0 && (c.Rule == nil || len(c.Rule.Rules) == 0)
+	})
+}
+
+// Lookup returns the result of a descendant rule, given the path of rule IDs
+// from this result to the rule, separated by a slash. For example, if u is the
+// result of the rule "root", which has a child rule "offers", which in turn
+// has a child "summer", the result of "summer" is found with
+//
+//	u.Lookup("offers/summer")
+//
+// An empty path returns u itself.
+func (u *Result) Lookup(path string) (*Result, bool) {
+	c := u
+	if path == "" {
+		return c, true
+	}
+	for _, id := range strings.Split(path, "/") {
+		next, ok := c.Results[id]
+		if !ok || next == nil {
+			return nil, false
+		}
+		c = next
+	}
+	return c, true
+}
+
+// childResults returns the child results in evaluation order.
+func (u *Result) childResults() []*Result {
+	l := make([]*Result, 0, len(u.Results))
+	seen := make(map[string]bool, len(u.Results))
+
+	for _, r := range u.RulesEvaluated {
+		if c, ok := u.Results[r.ID]; ok && !seen[r.ID] {
+			l = append(l, c)
+			seen[r.ID] = true
+		}
+	}
+
+	if len(l) == len(u.Results) {
+		return l
+	}
+
+	// Results not in RulesEvaluated are ordered as the child rules are
+	// ordered, followed by any others by ID
+	rules := make([]*Rule, 0, len(u.Results)-len(l))
+	if u.Rule != nil {
+		for _, k := range u.Rule.childOrder() {
+			if c, ok := u.Results[k]; ok && !seen[k] {
+				rules = append(rules, c.Rule)
+				seen[k] = true
+			}
+		}
+	}
+
+	rest := make([]*Rule, 0, len(u.Results)-len(l)-len(rules))
+	for k, c := range u.Results {
+		if !seen[k] {
+			rest = append(rest, c.Rule)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool {
+		return rest[i].ID < rest[j].ID
+	})
+	rules = append(rules, rest...)
+
+	if fn := u.EvalOptions.sortFunc(); fn != nil {
+		sort.SliceStable(rules, func(i, j int) bool {
+			return fn(rules, i, j)
+		})
+	}
+
+	for _, r := range rules {
+		l = append(l, u.Results[r.ID])
+	}
+	return l
+}
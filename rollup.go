@@ -0,0 +1,94 @@
+package indigo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// RollUp specifies how the results of a parent rule's child rules are
+// combined into the parent rule's pass/fail result.
+//
+// With every roll-up mode, the parent rule only passes if its own expression
+// passes. Roll-up modes have no effect on rules without child rules, or on
+// rules with a hit policy (see HitPolicy).
+type RollUp int
+
+const (
+	// RollUpAll means that all child rules must pass, or, if the TrueIfAny
+	// option is set, at least one child rule must pass. This is the default.
+	RollUpAll RollUp = iota
+
+	// RollUpAtLeast means that at least Threshold child rules must pass
+	// ("N of M"). The Result's Score is the number of child rules that passed.
+	RollUpAtLeast
+
+	// RollUpWeighted means that the sum of the Weight of the child rules that
+	// passed must be at least Threshold. The Result's Score is the sum of the
+	// weights.
+	RollUpWeighted
+
+	// RollUpNone means that no child rule may pass. Use it for exclusion rules,
+	// where any child rule that passes disqualifies the parent. The Result's
+	// Score is the number of child rules that passed.
+	RollUpNone
+
+	// RollUpExactlyOne means that exactly one child rule must pass (XOR).
+	// The Result's Score is the number of child rules that passed.
+	RollUpExactlyOne
+)
+
+// String returns a human-readable name of the roll-up mode.
+func (r RollUp) String() string {
+	switch r {
+	case RollUpAll:
+		return "all"
+	case RollUpAtLeast:
+		return "at least"
+	case RollUpWeighted:
+		return "weighted"
+	case RollUpNone:
+		return "none of"
+	case RollUpExactlyOne:
+		return "exactly one of"
+	default:
+		return fmt.Sprintf("RollUp(%d)", int(r))
+	}
+}
+
+// rollUpString describes the roll-up of the evaluation options, for
+// Result.String. Blank for the default.
+func rollUpString(o EvalOptions) string {
+	t := strconv.FormatFloat(o.Threshold, 'g', -1, 64)
+	switch o.RollUp {
+	case RollUpAll:
+		return ""
+	case RollUpAtLeast:
+		return "at least " + t
+	case RollUpWeighted:
+		return "weight >= " + t
+	default:
+		return o.RollUp.String()
+	}
+}
+
+// applyRollUp sets the pass/fail and score of the parent result u, based on
+// the number of child rules that passed and the sum of their weights.
+func applyRollUp(u *Result, o EvalOptions, passCount int, passWeight float64) error {
+	switch o.RollUp {
+	case RollUpAtLeast:
+		u.Score = float64(passCount)
+		u.Pass = u.ExpressionPass && u.Score >= o.Threshold
+	case RollUpWeighted:
+		u.Score = passWeight
+		u.Pass = u.ExpressionPass && u.Score >= o.Threshold
+	case RollUpNone:
+		u.Score = float64(passCount)
+		u.Pass = u.ExpressionPass && passCount == 0
+	case RollUpExactlyOne:
+		u.Score = float64(passCount)
+		u.Pass = u.ExpressionPass && passCount == 1
+	default:
+		return fmt.Errorf("unknown roll-up %s", o.RollUp)
+	}
+	return nil
+}
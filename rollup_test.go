@@ -0,0 +1,129 @@
+package indigo_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/matryer/is"
+)
+
+// makeRiskRule returns a rule with five children, three of which pass.
+func makeRiskRule() *indigo.Rule {
+	r := indigo.NewRule("risk", "true")
+	for _, c := range []*indigo.Rule{
+		{ID: "new_account", Expr: "true", Weight: 2},
+		{ID: "foreign_ip", Expr: "true", Weight: 1.5},
+		{ID: "large_amount", Expr: "false", Weight: 3},
+		{ID: "night_time", Expr: "true", Weight: 0.5},
+		{ID: "velocity", Expr: "false", Weight: 1},
+	} {
+		_ = r.AddChild(c)
+	}
+	return r
+}
+
+func TestRollUpAtLeast(t *testing.T) {
+	is := is.New(t)
+	e := indigo.NewEngine(newMockEvaluator())
+	r := makeRiskRule()
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{}, indigo.AtLeast(3))
+	is.NoErr(err)
+	is.True(u.Pass)
+	is.Equal(u.Score, 3.0)
+
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.AtLeast(4))
+	is.NoErr(err)
+	is.True(!u.Pass)
+	is.Equal(u.Score, 3.0)
+
+	// child rules without children are not affected by the roll-up
+	is.True(u.Results["new_account"].Pass)
+	is.Equal(u.Results["new_account"].Score, 0.0)
+
+	// the parent's expression must still pass
+	r.Expr = "false"
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.AtLeast(1))
+	is.NoErr(err)
+	is.True(!u.Pass)
+}
+
+func TestRollUpWeighted(t *testing.T) {
+	is := is.New(t)
+	e := indigo.NewEngine(newMockEvaluator())
+	r := makeRiskRule()
+	r.EvalOptions.RollUp = indigo.RollUpWeighted
+	r.EvalOptions.Threshold = 4
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	is.True(u.Pass)
+	is.Equal(u.Score, 4.0)
+	is.True(strings.Contains(u.String(), "weight >= 4"))
+
+	r.Rules["night_time"].Expr = "false"
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	is.True(!u.Pass)
+	is.Equal(u.Score, 3.5)
+
+	// the score is part of the JSON representation
+	b, err := json.Marshal(u)
+	is.NoErr(err)
+	u2 := &indigo.Result{}
+	is.NoErr(json.Unmarshal(b, u2))
+	is.Equal(u2.Score, 3.5)
+}
+
+func TestRollUpNoneOf(t *testing.T) {
+	is := is.New(t)
+	e := indigo.NewEngine(newMockEvaluator())
+
+	r := indigo.NewRule("exclusions", "true")
+	r.EvalOptions.RollUp = indigo.RollUpNone
+	is.NoErr(r.AddChild(indigo.NewRule("sanctioned", "false")))
+	is.NoErr(r.AddChild(indigo.NewRule("blocked", "false")))
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	is.True(u.Pass)
+	is.Equal(u.Score, 0.0)
+	is.True(strings.Contains(u.String(), "none of"))
+
+	r.Rules["blocked"].Expr = "true"
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	is.True(!u.Pass)
+	is.True(u.ExpressionPass)
+	is.Equal(u.Score, 1.0)
+}
+
+func TestRollUpExactlyOneOf(t *testing.T) {
+	is := is.New(t)
+	e := indigo.NewEngine(newMockEvaluator())
+	r := makeRiskRule()
+	is.NoErr(e.Compile(r))
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{}, indigo.ExactlyOneOf())
+	is.NoErr(err)
+	is.True(!u.Pass)
+	is.Equal(u.Score, 3.0)
+
+	r.Rules["new_account"].Expr = "false"
+	r.Rules["foreign_ip"].Expr = "false"
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.ExactlyOneOf())
+	is.NoErr(err)
+	is.True(u.Pass)
+	is.True(strings.Contains(u.String(), "exactly one of"))
+
+	// NoneOf given at evaluation time
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.NoneOf())
+	is.NoErr(err)
+	is.True(!u.Pass)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
@@ -39,6 +40,11 @@ type Rule struct {
 	// A rule identifer. (required)
 	ID string `json:"id"`
 
+	// An identifier for the version of the rule, such as "3" or "2023-01-15".
+	// The version is recorded in the Result of every evaluation of the rule,
+	// and is used by a RuleStore to keep the history of a rule tree. (optional)
+	Version string `json:"version,omitempty"`
+
 	// The expression to evaluate (optional)
 	// The expression can return a boolean (true or false), or any
 	// other value the underlying expression engine can produce.
@@ -55,8 +61,67 @@ type Rule struct {
 
 	// The schema describing the data provided in the Evaluate input. (optional)
 	// Some implementations of Evaluator require a schema.
+	// A rule with an empty schema (no ID and no elements) inherits the schema
+	// of its parent rule when the rule tree is compiled; see EffectiveSchema.
 	Schema Schema `json:"schema,omitempty"`
 
+	// Data elements added to the rule's schema, or to the schema inherited
+	// from the parent rule. Use it to extend the parent's schema for a child
+	// rule that uses additional data. (optional)
+	ExtraElements []DataElement `json:"extra_elements,omitempty"`
+
+	// The IDs of rules whose results this rule's expression uses. The rules
+	// must be in the same rule tree, with unique IDs. Their results are
+	// available to the expression in the reserved data element "rules":
+	//
+	//	rules.is_vip.pass              // whether the rule passed
+	//	rules.is_vip.expression_pass   // whether the rule's expression passed
+	//	rules.tax.value                // the rule's value
+	//
+	// The engine evaluates the rules a rule depends on before the rule itself,
+	// and evaluates each rule only once during an evaluation, even if several
+	// rules depend on it. A rule cannot depend on itself or on its ancestors,
+	// since a parent rule's result depends on its children; the engine
+	// returns an error at compile time if there is a dependency cycle.
+	// The rule tree must be compiled from its root for the dependencies to be
+	// resolved. (optional)
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// A fixed value returned in the Result's Value instead of the expression's
+	// output, if the expression passes. The expression is then the condition
+	// under which the rule produces the output. Use Output for the child rules
+	// of a rule with a hit policy (see HitPolicy), which selects among the
+	// outputs of the child rules whose conditions are true, such as the rows
+	// of a DecisionTable. (optional)
+	Output interface{} `json:"output,omitempty"`
+
+	// The weight of the rule, added to the parent rule's score if the rule
+	// passes and the parent rule uses the RollUpWeighted roll-up. (optional)
+	Weight float64 `json:"weight,omitempty"`
+
+	// The priority (salience) of the rule relative to its siblings. Higher
+	// priority rules are evaluated first when the parent rule's child rules are
+	// sorted by priority (see SortByPriority and SortRulesPriority). (optional)
+	Priority int `json:"priority,omitempty"`
+
+	// The names of the actions to execute after evaluation if the rule passes,
+	// or fails. The actions are looked up in the ActionRegistry provided
+	// with the RunActions evaluation option; without it, no actions are
+	// executed. (optional)
+	OnPass []string `json:"on_pass,omitempty"`
+	OnFail []string `json:"on_fail,omitempty"`
+
+	// Disabled rules are not evaluated. Use it to switch off a rule without
+	// removing it from the rule tree. (optional)
+	Disabled bool `json:"disabled,omitempty"`
+
+	// The period during which the rule is in effect: from EffectiveFrom
+	// (inclusive) until EffectiveUntil (exclusive). A zero time means the
+	// period is unbounded. Rules are not evaluated outside the period; see
+	// the Clock evaluation option for setting the time of the evaluation. (optional)
+	EffectiveFrom  time.Time `json:"effective_from,omitempty"`
+	EffectiveUntil time.Time `json:"effective_until,omitempty"`
+
 	// A reference to an object whose values can be used in the rule expression.
 	// Add the corresponding object in the data with the reserved key name selfKey
 	// (see constants).
@@ -64,6 +129,10 @@ type Rule struct {
 	Self interface{} `json:"-"`
 
 	// A set of child rules.
+	// Child rules are evaluated in the order they were added with AddChild,
+	// unless a SortFunc is specified in the evaluation options. Child rules
+	// added directly to the map are evaluated after those added with AddChild,
+	// in order of their IDs.
 	Rules map[string]*Rule `json:"rules,omitempty"`
 
 	// Reference to intermediate compilation / evaluation data.
@@ -79,15 +148,42 @@ type Rule struct {
 	// sortedRules contains a list of child rules, sorted by the
 	// EvalOptions.SortFunc. During rule evaluation, the rules are evaluated in
 	// the order they appear in this list. The sorted list is calculated at
-	// compile time. If SortFunc is not specified, the evaluation order is
-	// unspecified.
+	// compile time. If SortFunc is not specified, the rules are in the
+	// order they were added.
 	sortedRules []*Rule
+
+	// order holds the IDs of the child rules in the order they were added
+	// with AddChild.
+	order []string
+
+	// hash is the content hash of the rule and its children, calculated at
+	// compile time.
+	hash string
+
+	// deps holds the rules listed in DependsOn, resolved at compile time.
+	deps []*Rule
+
+	// referenced is set at compile time if other rules depend on this rule.
+	referenced bool
+
+	// template holds the parameter values of a rule created from a compiled
+	// RuleTemplate, which are provided as data when the rule is evaluated.
+	template *templateBinding
+
+	// effective is the schema used to compile and evaluate the rule,
+	// resolved at compile time.
+	effective *Schema
 }
 
 const (
 	// If the rule includes a Self object, it will be made available in the input
 	// data with this key name.
 	selfKey = "self"
+
+	// RulesKey is the name of the data element holding the results of the
+	// rules a rule depends on (see Rule.DependsOn). It is reserved: schemas
+	// of rules with dependencies cannot have an element with this name.
+	RulesKey = "rules"
 )
 
 // NewRule initializes a rule with the ID and rule expression.
@@ -106,7 +202,7 @@ func ApplyToRule(r *Rule, f func(r *Rule) error) error {
 	if err != nil {
 		return err
 	}
-	for _, c := range r.Rules {
+	for _, c := range r.orderedChildren() {
 		err := ApplyToRule(c, f)
 		if err != nil {
 			return err
@@ -153,7 +249,7 @@ func (r *Rule) rulesToRows(n int) ([]table.Row, int) {
 
 	row := table.Row{
 		fmt.Sprintf("%s%s", indent, r.ID),
-		r.Schema.ID,
+		r.EffectiveSchema().ID,
 		r.Expr,
 		fmt.Sprintf("%v", r.ResultType),
 		fmt.Sprintf("%T", r.Meta),
@@ -161,7 +257,7 @@ func (r *Rule) rulesToRows(n int) ([]table.Row, int) {
 	rows = append(rows, row)
 	maxExprLength := len(r.Expr)
 
-	for _, c := range r.Rules {
+	for _, c := range r.Children() {
 		cr, max := c.rulesToRows(n + 1)
 		if max > maxExprLength {
 			maxExprLength = max
@@ -172,47 +268,199 @@ func (r *Rule) rulesToRows(n int) ([]table.Row, int) {
 }
 
 // sortChildRules returns a list of rules, ordered by the function.
-// With a nil function, returns either a cached list of rules (whose sort order may
-// have been set by a previous sort operation), or a list of rules whose order
-// is not defined.
+// With a nil function, the rules are returned in the order they were added
+// (see AddChild). If force is false, returns the cached list of rules (whose
+// sort order may have been set by a previous sort operation), if it is
+// current.
 func (r *Rule) sortChildRules(fn func(rules []*Rule, i, j int) bool, force bool) []*Rule {
 
-	if fn == nil && len(r.sortedRules) == len(r.Rules) {
+	if !force && len(r.sortedRules) == len(r.Rules) {
 		return r.sortedRules
 	}
 
-	if !force && len(r.sortedRules) == len(r.Rules) {
-		return r.sortedRules
+	keys := r.orderedChildren()
+
+	if fn != nil && len(keys) > 0 {
+		sort.SliceStable(keys, func(i, j int) bool {
+			return fn(keys, i, j)
+		})
 	}
 
-	//	fmt.Println("  ", op, force, "getting keys for ", r.ID)
-	keys := make([]*Rule, len(r.Rules), len(r.Rules))
-	var i int
-	for k := range r.Rules {
-		keys[i] = r.Rules[k]
-		i++
+	return keys
+}
+
+// orderedChildren returns the child rules in the order they were added with
+// AddChild, followed by any rules added directly to the Rules map, sorted
+// by ID.
+func (r *Rule) orderedChildren() []*Rule {
+	ids := r.childOrder()
+	keys := make([]*Rule, len(ids))
+	for i := range ids {
+		keys[i] = r.Rules[ids[i]]
 	}
+	return keys
+}
 
-	if fn != nil && len(keys) > 0 && force {
+// Children returns the child rules in evaluation order: the order
+// they were added (see AddChild), or the order given by the SortFunc or
+// SortByPriority evaluation options.
+func (r *Rule) Children() []*Rule {
+	return r.sortChildRules(r.EvalOptions.sortFunc(), false)
+}
 
-		//		fmt.Println("  ", op, force, "sorting keys for ", r.ID, "--")
-		sort.Slice(keys, func(i, j int) bool {
-			return fn(keys, i, j)
-		})
+// EffectiveSchema returns the schema used to compile and evaluate the rule:
+// the rule's Schema, or, if it is empty, the effective schema of its parent
+// rule, with the ExtraElements added. The schema is resolved when the rule
+// tree is compiled; if the rule has not been compiled, the parent's schema
+// is not known, and the rule's own schema is used.
+func (r *Rule) EffectiveSchema() Schema {
+	if r.effective != nil {
+		return *r.effective
+	}
+	s, err := r.ResolveSchema(Schema{})
+	if err != nil {
+		return r.Schema
+	}
+	return s
+}
+
+// ResolveSchema returns the rule's effective schema (see EffectiveSchema),
+// given the effective schema of its parent rule, without compiling the rule.
+// It returns an error if an extra element has the name of an element already
+// in the schema.
+func (r *Rule) ResolveSchema(inherited Schema) (Schema, error) {
+	s := r.Schema
+	if s.ID == "" && len(s.Elements) == 0 {
+		s = inherited
+	}
+	if len(r.ExtraElements) == 0 {
+		return s, nil
+	}
+
+	names := make(map[string]bool, len(s.Elements))
+	for _, e := range s.Elements {
+		names[e.Name] = true
 	}
 
-	/*
-		if len(keys) > 0 {
-		fmt.Printf("  sorted: ")
-			for _, x := range keys {
-				if x != nil {
-					fmt.Printf("%s ", x.ID)
-				}
-			}
-			fmt.Printf("\n")
+	elements := append(make([]DataElement, 0, len(s.Elements)+len(r.ExtraElements)), s.Elements...)
+	for _, e := range r.ExtraElements {
+		if names[e.Name] {
+			return Schema{}, fmt.Errorf("rule %s: extra element %s is already in the schema", r.ID, e.Name)
 		}
-	*/
-	return keys
+		names[e.Name] = true
+		elements = append(elements, e)
+	}
+	s.Elements = elements
+	return s, nil
+}
+
+// InEffect reports whether the rule is enabled and in effect at time t
+// (see Disabled, EffectiveFrom and EffectiveUntil).
+func (r *Rule) InEffect(t time.Time) bool {
+	switch {
+	case r.Disabled:
+		return false
+	case !r.EffectiveFrom.IsZero() && t.Before(r.EffectiveFrom):
+		return false
+	case !r.EffectiveUntil.IsZero() && !t.Before(r.EffectiveUntil):
+		return false
+	default:
+		return true
+	}
+}
+
+// scheduled reports whether the rule has an effective period.
+func (r *Rule) scheduled() bool {
+	return !r.EffectiveFrom.IsZero() || !r.EffectiveUntil.IsZero()
+}
+
+// AddChild adds a child rule after any existing child rules.
+// Returns an error if the rule already has a child with the same ID.
+func (r *Rule) AddChild(c *Rule) error {
+	if c == nil {
+		return fmt.Errorf("rule %s: child rule is nil", r.ID)
+	}
+	if _, ok := r.Rules[c.ID]; ok {
+		return fmt.Errorf("rule %s: child rule %s already exists", r.ID, c.ID)
+	}
+	if r.Rules == nil {
+		r.Rules = map[string]*Rule{}
+	}
+	r.order = r.childOrder()
+	r.order = append(r.order, c.ID)
+	r.Rules[c.ID] = c
+	r.sortedRules = nil
+	return nil
+}
+
+// RemoveChild removes the child rule with the ID, returning the rule removed,
+// or nil if there is no such child.
+func (r *Rule) RemoveChild(id string) *Rule {
+	c, ok := r.Rules[id]
+	if !ok {
+		return nil
+	}
+	r.order = r.childOrder()
+	for i := range r.order {
+		if r.order[i] == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	delete(r.Rules, id)
+	r.sortedRules = nil
+	return c
+}
+
+// MoveChild moves the child rule with the ID to the position (0-based)
+// among the child rules.
+func (r *Rule) MoveChild(id string, position int) error {
+	if _, ok := r.Rules[id]; !ok {
+		return fmt.Errorf("rule %s: child rule %s not found", r.ID, id)
+	}
+	if position < 0 || position >= len(r.Rules) {
+		return fmt.Errorf("rule %s: position %d out of range", r.ID, position)
+	}
+
+	order := r.childOrder()
+	ids := make([]string, 0, len(order))
+	for _, x := range order {
+		if x != id {
+			ids = append(ids, x)
+		}
+	}
+	ids = append(ids[:position], append([]string{id}, ids[position:]...)...)
+
+	r.order = ids
+	r.sortedRules = nil
+	return nil
+}
+
+// childOrder returns the IDs of the child rules in the order they were added
+// with AddChild, followed by any rules added directly to the Rules map,
+// sorted by ID.
+func (r *Rule) childOrder() []string {
+	ids := make([]string, 0, len(r.Rules))
+	seen := make(map[string]bool, len(r.order))
+	for _, id := range r.order {
+		if _, ok := r.Rules[id]; ok && !seen[id] {
+			ids = append(ids, id)
+			seen[id] = true
+		}
+	}
+
+	if len(ids) == len(r.Rules) {
+		return ids
+	}
+
+	rest := make([]string, 0, len(r.Rules)-len(ids))
+	for id := range r.Rules {
+		if !seen[id] {
+			rest = append(rest, id)
+		}
+	}
+	sort.Strings(rest)
+	return append(ids, rest...)
 }
 
 // SortRulesAlpha will sort rules alphabetically by their rule ID
@@ -220,6 +468,15 @@ func SortRulesAlpha(rules []*Rule, i, j int) bool {
 	return rules[i].ID < rules[j].ID
 }
 
+// SortRulesPriority will sort rules by their Priority, highest first.
+// Rules with the same priority are sorted alphabetically by their rule ID.
+func SortRulesPriority(rules []*Rule, i, j int) bool {
+	if rules[i].Priority != rules[j].Priority {
+		return rules[i].Priority > rules[j].Priority
+	}
+	return rules[i].ID < rules[j].ID
+}
+
 // SortRulesAlphaDesc will sort rules alphabetically (descending) by their rule ID
 func SortRulesAlphaDesc(rules []*Rule, i, j int) bool {
 	return rules[i].ID > rules[j].ID
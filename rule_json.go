@@ -0,0 +1,133 @@
+package indigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MarshalJSON encodes the rule and its children as JSON. The child rules are
+// written in evaluation order (see AddChild), so that the order is preserved
+// when the rule is decoded with UnmarshalJSON.
+func (r *Rule) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+
+	type alias Rule
+	j := struct {
+		*alias
+		Rules          *childRules `json:"rules,omitempty"`
+		EffectiveFrom  *time.Time  `json:"effective_from,omitempty"`
+		EffectiveUntil *time.Time  `json:"effective_until,omitempty"`
+	}{
+		alias: (*alias)(r),
+	}
+	if len(r.Rules) > 0 {
+		j.Rules = &childRules{r: r}
+	}
+
+	// zero times mean the period is unbounded, and are omitted
+	if !r.EffectiveFrom.IsZero() {
+		j.EffectiveFrom = &r.EffectiveFrom
+	}
+	if !r.EffectiveUntil.IsZero() {
+		j.EffectiveUntil = &r.EffectiveUntil
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes a rule encoded by MarshalJSON, keeping the order
+// of the child rules.
+func (r *Rule) UnmarshalJSON(b []byte) error {
+	type alias Rule
+	j := struct {
+		*alias
+		Rules json.RawMessage `json:"rules,omitempty"`
+	}{
+		alias: (*alias)(r),
+	}
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+
+	r.Rules = nil
+	r.order = nil
+	r.sortedRules = nil
+	if len(j.Rules) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(j.Rules, &r.Rules); err != nil {
+		return err
+	}
+
+	order, err := objectKeys(j.Rules)
+	if err != nil {
+		return err
+	}
+	r.order = order
+	return nil
+}
+
+// childRules encodes the child rules of a rule as a JSON object, in order.
+type childRules struct {
+	r *Rule
+}
+
+func (c *childRules) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, k := range c.r.childOrder() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(c.r.Rules[k])
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", k, err)
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// objectKeys returns the keys of a JSON object in the order they appear.
+func objectKeys(b []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, nil
+	}
+	if d, ok := t.(json.Delim); !ok || d != '{' {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+
+	keys := []string{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		k, ok := t.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a JSON object key")
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
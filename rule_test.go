@@ -1,6 +1,8 @@
 package indigo_test
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 
 	"github.com/ezachrisen/indigo"
@@ -16,3 +18,130 @@ func TestNew(t *testing.T) {
 	is.True(r.ID == "blah")
 	is.True(len(r.Schema.Elements) == 0)
 }
+
+func childIDs(rules []*indigo.Rule) []string {
+	ids := []string{}
+	for _, r := range rules {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestChildOrder(t *testing.T) {
+	is := is.New(t)
+
+	r := indigo.NewRule("root", "")
+	for _, id := range []string{"c", "a", "b"} {
+		is.NoErr(r.AddChild(indigo.NewRule(id, "true")))
+	}
+	is.True(r.AddChild(indigo.NewRule("a", "")) != nil) // duplicate ID
+	is.Equal(childIDs(r.Children()), []string{"c", "a", "b"})
+
+	// rules added directly to the map come last, by ID
+	r.Rules["z"] = indigo.NewRule("z", "true")
+	r.Rules["y"] = indigo.NewRule("y", "true")
+	is.Equal(childIDs(r.Children()), []string{"c", "a", "b", "y", "z"})
+
+	is.NoErr(r.MoveChild("b", 0))
+	is.Equal(childIDs(r.Children()), []string{"b", "c", "a", "y", "z"})
+	is.NoErr(r.MoveChild("b", 4))
+	is.Equal(childIDs(r.Children()), []string{"c", "a", "y", "z", "b"})
+	is.True(r.MoveChild("b", 5) != nil)
+	is.True(r.MoveChild("x", 0) != nil)
+
+	is.Equal(r.RemoveChild("y").ID, "y")
+	is.True(r.RemoveChild("y") == nil)
+	is.Equal(childIDs(r.Children()), []string{"c", "a", "z", "b"})
+
+	// a SortFunc overrides the insertion order
+	r.EvalOptions.SortFunc = indigo.SortRulesAlpha
+	is.Equal(childIDs(r.Children()), []string{"a", "b", "c", "z"})
+
+	// the clone keeps the order
+	r.EvalOptions.SortFunc = nil
+	is.Equal(childIDs(r.Clone().Children()), []string{"c", "a", "z", "b"})
+}
+
+func TestChildOrderEval(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(newMockEvaluator())
+	r := indigo.NewRule("root", "true")
+	r.EvalOptions.StopFirstPositiveChild = true
+	for _, id := range []string{"c", "b", "a"} {
+		is.NoErr(r.AddChild(indigo.NewRule(id, "true")))
+	}
+	is.NoErr(e.Compile(r))
+
+	for i := 0; i < 10; i++ {
+		u, err := e.Eval(context.Background(), r, map[string]interface{}{}, indigo.ReturnDiagnostics(true))
+		is.NoErr(err)
+		is.Equal(childIDs(u.RulesEvaluated), []string{"c"})
+	}
+
+	is.NoErr(r.MoveChild("a", 0))
+	is.NoErr(e.Compile(r))
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	_, ok := u.Results["a"]
+	is.True(ok)
+	is.Equal(len(u.Results), 1)
+
+	// without diagnostics, results are listed in rule order
+	r.EvalOptions.StopFirstPositiveChild = false
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	ids := []string{}
+	for _, c := range u.Flatten()[1:] {
+		ids = append(ids, c.Rule.ID)
+	}
+	is.Equal(ids, []string{"a", "c", "b"})
+}
+
+func TestSortByPriority(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(newMockEvaluator())
+	r := indigo.NewRule("root", "true")
+	r.EvalOptions.StopFirstPositiveChild = true
+	r.EvalOptions.SortByPriority = true
+	for _, c := range []*indigo.Rule{
+		{ID: "low", Expr: "true", Priority: 1},
+		{ID: "high-b", Expr: "true", Priority: 10},
+		{ID: "high-a", Expr: "true", Priority: 10},
+		{ID: "none", Expr: "true"},
+	} {
+		is.NoErr(r.AddChild(c))
+	}
+	is.NoErr(e.Compile(r))
+	is.Equal(childIDs(r.Children()), []string{"high-a", "high-b", "low", "none"})
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	is.Equal(len(u.Results), 1)
+	_, ok := u.Results["high-a"]
+	is.True(ok)
+
+	// the priority and sort option survive a JSON round trip
+	b, err := json.Marshal(r)
+	is.NoErr(err)
+	r2 := &indigo.Rule{}
+	is.NoErr(json.Unmarshal(b, r2))
+	is.True(r2.EvalOptions.SortByPriority)
+	is.Equal(r2.Rules["high-a"].Priority, 10)
+	is.Equal(r2.Hash(), r.Hash())
+
+	// a SortFunc passed to Eval overrides the priority order
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.SortFunc(indigo.SortRulesAlphaDesc))
+	is.NoErr(err)
+	_, ok = u.Results["none"]
+	is.True(ok)
+
+	// and the priority order can be requested at evaluation time
+	r.EvalOptions.SortByPriority = false
+	is.NoErr(e.Compile(r))
+	u, err = e.Eval(context.Background(), r, map[string]interface{}{}, indigo.SortByPriority(true))
+	is.NoErr(err)
+	_, ok = u.Results["high-a"]
+	is.True(ok)
+}
@@ -11,7 +11,8 @@ import (
 
 // Schema defines the variable names and their data types used in a
 // rule expression. The same keys and types must be supplied in the data map
-// when rules are evaluated.
+// when rules are evaluated; use Validate or the ValidateInput option to
+// check the data.
 type Schema struct {
 	// Identifier for the schema. Useful for the hosting application; not used by Indigo internally.
 	ID string `json:"id,omitempty"`
@@ -55,10 +56,17 @@ type DataElement struct {
 
 	// Optional description of the type.
 	Description string `json:"description"`
+
+	// Optional elements may be missing from the input data when it is
+	// validated (see Schema.Validate).
+	Optional bool `json:"optional,omitempty"`
 }
 
 // String returns a human-readable representation of the element
 func (e *DataElement) String() string {
+	if e.Optional {
+		return fmt.Sprintf("  %s (%s, optional)", e.Name, e.Type)
+	}
 	return fmt.Sprintf("  %s (%s)", e.Name, e.Type)
 }
 
@@ -1,10 +1,13 @@
 package indigo_test
 
 import (
+	"context"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
 	"github.com/ezachrisen/indigo/testdata/school"
 	"github.com/matryer/is"
 )
@@ -142,3 +145,60 @@ func TestParser(t *testing.T) {
 		}
 	}
 }
+
+func TestSchemaInheritance(t *testing.T) {
+	is := is.New(t)
+
+	metrics := indigo.Schema{
+		ID: "metrics",
+		Elements: []indigo.DataElement{
+			{Name: "cpu", Type: indigo.Int{}},
+			{Name: "memory", Type: indigo.Int{}},
+		},
+	}
+
+	root := &indigo.Rule{ID: "alarms", Schema: metrics}
+	memory := &indigo.Rule{
+		ID:            "memory",
+		ExtraElements: []indigo.DataElement{{Name: "swap", Type: indigo.Int{}}},
+		EvalOptions:   indigo.EvalOptions{TrueIfAny: true},
+	}
+	is.NoErr(root.AddChild(&indigo.Rule{ID: "cpu", Expr: `cpu > 90`}))
+	is.NoErr(root.AddChild(memory))
+	is.NoErr(memory.AddChild(&indigo.Rule{ID: "used", Expr: `memory > 90`}))
+	is.NoErr(memory.AddChild(&indigo.Rule{ID: "swap", Expr: `swap > 50 && memory > 50`}))
+	is.NoErr(root.AddChild(&indigo.Rule{
+		ID:     "disk",
+		Schema: indigo.Schema{ID: "disk", Elements: []indigo.DataElement{{Name: "free", Type: indigo.Int{}}}},
+		Expr:   `free < 10`,
+	}))
+
+	// before compilation, only the rule's own schema is known
+	is.Equal(root.Rules["cpu"].EffectiveSchema().ID, "")
+	is.Equal(len(memory.EffectiveSchema().Elements), 1)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(root))
+
+	is.Equal(root.Rules["cpu"].EffectiveSchema().ID, "metrics")
+	is.Equal(len(memory.EffectiveSchema().Elements), 3)
+	is.Equal(len(memory.Rules["swap"].EffectiveSchema().Elements), 3)
+	is.Equal(root.Rules["disk"].EffectiveSchema().ID, "disk")
+	is.Equal(len(metrics.Elements), 2) // the parent's schema is not changed
+	is.True(strings.Contains(root.String(), "metrics"))
+
+	u, err := e.Eval(context.Background(), root, map[string]interface{}{"cpu": 95, "memory": 60, "swap": 70, "free": 5})
+	is.NoErr(err)
+	is.True(u.Pass)
+	is.True(u.Results["memory"].Results["swap"].Pass)
+
+	// a rule with its own schema does not inherit its parent's elements
+	root.Rules["disk"].Expr = `free < 10 && cpu > 10`
+	is.True(e.Compile(root) != nil)
+	root.Rules["disk"].Expr = `free < 10`
+
+	// extra elements cannot replace elements in the schema
+	memory.ExtraElements = append(memory.ExtraElements, indigo.DataElement{Name: "cpu", Type: indigo.Float{}})
+	err = e.Compile(root)
+	is.True(err != nil && strings.Contains(err.Error(), "extra element cpu"))
+}
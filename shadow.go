@@ -0,0 +1,280 @@
+package indigo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Shadow evaluates a primary rule tree and one or more candidate ("shadow")
+// rule trees against the same data. Only the result of the primary rule tree
+// is returned; the shadow rule trees are evaluated asynchronously after the
+// primary evaluation completes, and any divergences from the primary results
+// are reported to a callback.
+//
+// Use Shadow to trial a new version of a rule tree on live traffic without
+// affecting decisions. Shadow wraps the evaluator that evaluates the rules,
+// usually an Engine, and has the same Eval method, so it can replace the
+// engine where the calling application evaluates rules. It does not compile
+// rules; compile the rule trees with the engine.
+//
+// To keep shadow evaluations from competing with the primary evaluations
+// under load, at most MaxConcurrent shadow evaluations run at a time. Shadow
+// evaluations started while that many are running are dropped, and counted
+// (see Dropped).
+//
+// The shadow rule trees must be compiled, and must not be modified while
+// shadow evaluations are running. The input data is copied before it is passed
+// to the shadow evaluations, but the values in the data are shared with the
+// primary evaluation; the caller must not modify them.
+type Shadow struct {
+	// If set, shadow evaluations are canceled after this duration.
+	Timeout time.Duration
+
+	// The maximum number of shadow evaluations running at the same time.
+	// Set it before the first call to Eval.
+	// Default: 100
+	MaxConcurrent int
+
+	e       Evaluator
+	shadows []*Rule
+	report  func(ShadowReport)
+	wg      sync.WaitGroup
+
+	// sem holds a token for each running shadow evaluation
+	sem     chan struct{}
+	semOnce sync.Once
+
+	// the number of shadow evaluations dropped; accessed atomically
+	dropped int64
+}
+
+// defaultShadowConcurrency is the default limit on the number of shadow
+// evaluations running at the same time.
+const defaultShadowConcurrency = 100
+
+// ShadowReport holds the outcome of evaluating a shadow rule tree.
+type ShadowReport struct {
+	// The shadow rule tree evaluated
+	Shadow *Rule
+
+	// The results of the primary and shadow evaluations
+	Primary      *Result
+	ShadowResult *Result
+
+	// The rules whose results differ between the primary and shadow trees
+	Divergences []Divergence
+
+	// Set if the shadow evaluation failed
+	Err error
+}
+
+// Divergence describes a rule whose result is different in the shadow
+// rule tree than in the primary rule tree.
+type Divergence struct {
+	// The ID of the rule
+	RuleID string
+
+	// The location of the rule in the primary rule tree, as a list of rule
+	// IDs separated by a slash, starting with the root rule.
+	Path string
+
+	// Whether the rule has a result in the primary and shadow results
+	InPrimary bool
+	InShadow  bool
+
+	PrimaryPass bool
+	ShadowPass  bool
+
+	PrimaryValue interface{}
+	ShadowValue  interface{}
+}
+
+// NewShadow initializes a Shadow that evaluates rules with e. The report
+// function is called once for each shadow rule tree whose results diverge from
+// the primary results, or whose evaluation fails. It is called from a separate
+// goroutine, and must be safe for concurrent use.
+func NewShadow(e Evaluator, report func(ShadowReport), shadows ...*Rule) *Shadow {
+	return &Shadow{
+		e:       e,
+		shadows: shadows,
+		report:  report,
+	}
+}
+
+// Eval evaluates the primary rule r and returns its results. The shadow rule
+// trees are then evaluated in the background with the same data and options.
+// Decisions are not recorded, and actions are not executed, for the shadow
+// evaluations.
+//
+// If the Provider option is set, the shadow evaluations are not given the
+// provider, but the values it resolved for the primary evaluation, so that
+// no element is resolved twice. Elements the primary evaluation did not use
+// are missing from the shadows' data.
+func (s *Shadow) Eval(ctx context.Context, r *Rule, d map[string]interface{}, opts ...EvalOption) (*Result, error) {
+	if s == nil || s.e == nil {
+		return nil, fmt.Errorf("evaluator is nil")
+	}
+
+	// The primary evaluation resolves the values the shadows are given
+	o := EvalOptions{}
+	applyEvaluatorOptions(&o, opts...)
+	if o.provider != nil && r != nil {
+		d = lazyData(ctx, r, d, o.provider)
+	}
+
+	u, err := s.e.Eval(ctx, r, d, opts...)
+	if u == nil {
+		return nil, err
+	}
+
+	shadowOpts := append(append([]EvalOption{}, opts...), RecordDecisions(nil), RunActions(nil), Provider(nil))
+	resolved := resolvedData(d)
+
+	s.semOnce.Do(func() {
+		n := s.MaxConcurrent
+		if n <= 0 {
+			n = defaultShadowConcurrency
+		}
+		s.sem = make(chan struct{}, n)
+	})
+
+	for _, sr := range s.shadows {
+		// Drop the shadow evaluation rather than wait for one to finish
+		select {
+		case s.sem <- struct{}{}:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+			continue
+		}
+
+		data := make(map[string]interface{}, len(resolved))
+		for k, v := range resolved {
+			data[k] = v
+		}
+
+		s.wg.Add(1)
+		go func(sr *Rule) {
+			defer func() {
+				<-s.sem
+				s.wg.Done()
+			}()
+			s.evalShadow(sr, u, data, shadowOpts)
+		}(sr)
+	}
+
+	return u, err
+}
+
+// Wait blocks until all running shadow evaluations have completed.
+func (s *Shadow) Wait() {
+	s.wg.Wait()
+}
+
+// Dropped returns the number of shadow evaluations that were not run because
+// MaxConcurrent shadow evaluations were already running.
+func (s *Shadow) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// evalShadow evaluates one shadow rule tree and reports divergences.
+func (s *Shadow) evalShadow(sr *Rule, primary *Result, d map[string]interface{}, opts []EvalOption) {
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	rep := ShadowReport{
+		Shadow:  sr,
+		Primary: primary,
+	}
+
+	u, err := s.e.Eval(ctx, sr, d, opts...)
+	if err != nil {
+		rep.Err = err
+	} else {
+		rep.ShadowResult = u
+		rep.Divergences = diverge(primary, u)
+	}
+
+	if s.report != nil && (rep.Err != nil || len(rep.Divergences) > 0) {
+		s.report(rep)
+	}
+}
+
+// diverge compares the primary and shadow results, matching rules by their
+// location in the tree. The root rules are always matched, even if their IDs
+// are different.
+func diverge(primary, shadow *Result) []Divergence {
+	pm := flattenResults(primary, "", map[string]*Result{})
+	sm := flattenResults(shadow, "", map[string]*Result{})
+
+	paths := make([]string, 0, len(pm)+len(sm))
+	for k := range pm {
+		paths = append(paths, k)
+	}
+	for k := range sm {
+		if _, ok := pm[k]; !ok {
+			paths = append(paths, k)
+		}
+	}
+	sort.Strings(paths)
+
+	l := []Divergence{}
+	for _, p := range paths {
+		pu, su := pm[p], sm[p]
+		if pu != nil && su != nil && pu.Pass == su.Pass && valuesEqual(pu.Value, su.Value) {
+			continue
+		}
+
+		dv := Divergence{
+			Path:      joinPath(primary.Rule.ID, p),
+			InPrimary: pu != nil,
+			InShadow:  su != nil,
+		}
+		if pu != nil {
+			dv.RuleID = pu.Rule.ID
+			dv.PrimaryPass = pu.Pass
+			dv.PrimaryValue = pu.Value
+		}
+		if su != nil {
+			dv.RuleID = su.Rule.ID
+			dv.ShadowPass = su.Pass
+			dv.ShadowValue = su.Value
+		}
+		if p == "" {
+			dv.RuleID = primary.Rule.ID
+		}
+		l = append(l, dv)
+	}
+	return l
+}
+
+// flattenResults collects the results in the tree by their path, relative to
+// the root result.
+func flattenResults(u *Result, path string, m map[string]*Result) map[string]*Result {
+	m[path] = u
+	for k, c := range u.Results {
+		flattenResults(c, joinPath(path, k), m)
+	}
+	return m
+}
+
+// valuesEqual compares two result values, using proto.Equal for protocol buffers.
+func valuesEqual(a, b interface{}) bool {
+	if pa, ok := a.(proto.Message); ok {
+		if pb, ok := b.(proto.Message); ok {
+			return proto.Equal(pa, pb)
+		}
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,115 @@
+package indigo_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/matryer/is"
+)
+
+func TestShadow(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(newMockEvaluator())
+
+	primary := makeRule()
+	same := makeRule()
+	candidate := makeRule()
+	candidate.ID = "rule1-v2"
+	candidate.Rules["D"].Rules["d2"].Expr = `true`
+	delete(candidate.Rules["E"].Rules, "e3")
+
+	for _, r := range []*indigo.Rule{primary, same, candidate} {
+		is.NoErr(e.Compile(r))
+	}
+
+	mu := sync.Mutex{}
+	reports := map[string]indigo.ShadowReport{}
+	report := func(r indigo.ShadowReport) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports[r.Shadow.ID] = r
+	}
+
+	s := indigo.NewShadow(e, report, same, candidate)
+	u, err := s.Eval(context.Background(), primary, map[string]interface{}{})
+	is.NoErr(err)
+	is.Equal(u.Rule, primary)
+	s.Wait()
+
+	// only the candidate diverges
+	is.Equal(len(reports), 1)
+	rep, ok := reports["rule1-v2"]
+	is.True(ok)
+	is.NoErr(rep.Err)
+
+	// the root rule fails in both trees (B and E fail), so it does not diverge
+	want := []indigo.Divergence{
+		{RuleID: "D", Path: "rule1/D", InPrimary: true, InShadow: true, PrimaryPass: false, ShadowPass: true, PrimaryValue: true, ShadowValue: true},
+		{RuleID: "d2", Path: "rule1/D/d2", InPrimary: true, InShadow: true, PrimaryPass: false, ShadowPass: true, PrimaryValue: false, ShadowValue: true},
+		{RuleID: "e3", Path: "rule1/E/e3", InPrimary: true, InShadow: false, PrimaryPass: true, PrimaryValue: true},
+	}
+	is.Equal(rep.Divergences, want)
+}
+
+func TestShadowError(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(newMockEvaluator())
+	primary := makeRule()
+	is.NoErr(e.Compile(primary))
+
+	var got indigo.ShadowReport
+	s := indigo.NewShadow(e, func(r indigo.ShadowReport) { got = r }, &indigo.Rule{ID: "bad", Rules: map[string]*indigo.Rule{"x": nil}})
+	_, err := s.Eval(context.Background(), primary, map[string]interface{}{})
+	is.NoErr(err)
+	s.Wait()
+	is.True(got.Err != nil)
+}
+
+// blockingEvaluator blocks the evaluation of the shadow rule tree until
+// release is closed
+type blockingEvaluator struct {
+	indigo.Evaluator
+	release chan struct{}
+}
+
+func (b *blockingEvaluator) Eval(ctx context.Context, r *indigo.Rule, d map[string]interface{}, opts ...indigo.EvalOption) (*indigo.Result, error) {
+	if r.ID == "shadow" {
+		<-b.release
+	}
+	return b.Evaluator.Eval(ctx, r, d, opts...)
+}
+
+func TestShadowDropped(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(newMockEvaluator())
+	primary := makeRule()
+	shadow := makeRule()
+	shadow.ID = "shadow"
+	is.NoErr(e.Compile(primary))
+	is.NoErr(e.Compile(shadow))
+
+	b := &blockingEvaluator{Evaluator: e, release: make(chan struct{})}
+	s := indigo.NewShadow(b, nil, shadow)
+	s.MaxConcurrent = 2
+
+	// the third shadow evaluation is dropped while the first two are running
+	for i := 0; i < 3; i++ {
+		_, err := s.Eval(context.Background(), primary, map[string]interface{}{})
+		is.NoErr(err)
+	}
+	is.Equal(s.Dropped(), int64(1))
+
+	close(b.release)
+	s.Wait()
+
+	// once they have finished, shadow evaluations run again
+	_, err := s.Eval(context.Background(), primary, map[string]interface{}{})
+	is.NoErr(err)
+	s.Wait()
+	is.Equal(s.Dropped(), int64(1))
+}
@@ -0,0 +1,255 @@
+package indigo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Struct defines an Indigo type for a Go struct. Expressions select the
+// struct's exported fields by their Go names. Not all evaluators support
+// Go structs; the CEL evaluator does. Struct types cannot be parsed with
+// ParseType, since Go has no registry of types by name.
+//
+// The indigo tags of the struct's fields only name the data elements
+// SchemaFromStruct creates from the struct. Schema.Coerce converts JSON
+// objects to the struct with encoding/json, which matches the objects' keys
+// to the fields' json tags or Go names, and decisions record struct values
+// the same way.
+type Struct struct {
+	Value interface{} // an instance of the struct, or a pointer to one
+}
+
+// StructType returns the type of the struct.
+func (s Struct) StructType() (reflect.Type, error) {
+	if s.Value == nil {
+		return nil, fmt.Errorf("indigo.Struct.Value is nil")
+	}
+	t := reflect.TypeOf(s.Value)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("indigo.Struct.Value is a %v, not a struct", t)
+	}
+	return t, nil
+}
+
+// StructName returns the name of the struct type, qualified with the last
+// element of its package path, such as school.Student.
+func (s Struct) StructName() (string, error) {
+	t, err := s.StructType()
+	if err != nil {
+		return "", err
+	}
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	return pkg + "." + t.Name(), nil
+}
+
+func (s Struct) String() string {
+	n, err := s.StructName()
+	if err != nil {
+		return fmt.Sprintf("struct(missing name: %v)", err)
+	}
+	return "struct(" + n + ")"
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	protoType    = reflect.TypeOf((*proto.Message)(nil)).Elem()
+)
+
+// SchemaFromStruct returns a schema with a data element for each exported
+// field of the struct v (or the struct v points to), so that the schema can
+// be kept in sync with the struct the input data comes from. Use
+// DataFromStruct to create the input data from a value of the struct.
+//
+// The element is named after the field, or the name in the field's indigo
+// tag. Fields tagged "-" are skipped, and fields that are pointers or
+// tagged "optional" are optional elements:
+//
+//	type Order struct {
+//		Total    float64   `indigo:"total"`
+//		Customer *Customer `indigo:"customer"`
+//		Coupon   string    `indigo:"coupon,optional"`
+//		Internal string    `indigo:"-"`
+//	}
+//
+// The types of the fields map to Indigo types as follows: bool to Bool,
+// signed and unsigned integers to Int, floats to Float, string to String,
+// time.Time to Timestamp, time.Duration to Duration, interfaces to Any,
+// proto messages to Proto, other structs to Struct, and slices, arrays and
+// maps to Lists and Maps of their element types. Pointers map to the type
+// they point to. SchemaFromStruct returns an error for fields of other
+// types, and for unsigned integers in lists and maps.
+func SchemaFromStruct(v interface{}) (Schema, error) {
+	t, err := Struct{Value: v}.StructType()
+	if err != nil {
+		return Schema{}, err
+	}
+
+	fields, err := structFields(t)
+	if err != nil {
+		return Schema{}, err
+	}
+
+	s := Schema{ID: t.Name()}
+	for _, f := range fields {
+		typ, err := goType(f.field.Type, true)
+		if err != nil {
+			return Schema{}, fmt.Errorf("struct %v: field %s: %w", t, f.field.Name, err)
+		}
+		s.Elements = append(s.Elements, DataElement{Name: f.name, Type: typ, Optional: f.optional})
+	}
+	return s, nil
+}
+
+// DataFromStruct returns the input data for a schema created with
+// SchemaFromStruct from the value of the struct v (or the struct v points
+// to). Nil pointers are left out of the data, and unsigned integers are
+// converted to int64.
+func DataFromStruct(v interface{}) (map[string]interface{}, error) {
+	t, err := Struct{Value: v}.StructType()
+	if err != nil {
+		return nil, err
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("struct %v: pointer is nil", t)
+		}
+		rv = rv.Elem()
+	}
+
+	fields, err := structFields(t)
+	if err != nil {
+		return nil, err
+	}
+
+	d := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		fv := rv.FieldByIndex(f.field.Index)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			if !fv.Type().Implements(protoType) {
+				fv = fv.Elem()
+			}
+		}
+
+		switch fv.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			d[f.name] = int64(fv.Uint())
+		default:
+			d[f.name] = fv.Interface()
+		}
+	}
+	return d, nil
+}
+
+// structField is an exported field of a struct, and the name and optionality
+// of its data element.
+type structField struct {
+	field    reflect.StructField
+	name     string
+	optional bool
+}
+
+// structFields returns the exported fields of the struct type that are not
+// tagged "-".
+func structFields(t reflect.Type) ([]structField, error) {
+	l := []structField{}
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		sf := structField{field: f, name: f.Name, optional: f.Type.Kind() == reflect.Pointer}
+		if tag, ok := f.Tag.Lookup("indigo"); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				sf.name = parts[0]
+			}
+			for _, p := range parts[1:] {
+				switch p {
+				case "optional":
+					sf.optional = true
+				default:
+					return nil, fmt.Errorf("struct %v: field %s: unknown tag option %q", t, f.Name, p)
+				}
+			}
+		}
+
+		if names[sf.name] {
+			return nil, fmt.Errorf("struct %v: field %s: duplicate element name %s", t, f.Name, sf.name)
+		}
+		names[sf.name] = true
+		l = append(l, sf)
+	}
+	return l, nil
+}
+
+// goType returns the Indigo type of the Go type. Unsigned integers are only
+// allowed at the top level, where DataFromStruct converts them.
+func goType(t reflect.Type, top bool) (Type, error) {
+	switch {
+	case t == timeType:
+		return Timestamp{}, nil
+	case t == durationType:
+		return Duration{}, nil
+	case t.Kind() == reflect.Pointer && t.Implements(protoType):
+		return Proto{Message: reflect.New(t.Elem()).Interface().(proto.Message)}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return goType(t.Elem(), top)
+	case reflect.Bool:
+		return Bool{}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Int{}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if top {
+			return Int{}, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		return Float{}, nil
+	case reflect.String:
+		return String{}, nil
+	case reflect.Interface:
+		return Any{}, nil
+	case reflect.Struct:
+		return Struct{Value: reflect.New(t).Interface()}, nil
+	case reflect.Slice, reflect.Array:
+		el, err := goType(t.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+		return List{ValueType: el}, nil
+	case reflect.Map:
+		k, err := goType(t.Key(), false)
+		if err != nil {
+			return nil, err
+		}
+		v, err := goType(t.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+		return Map{KeyType: k, ValueType: v}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", t)
+}
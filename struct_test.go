@@ -0,0 +1,134 @@
+package indigo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/ezachrisen/indigo/testdata/school"
+	"github.com/matryer/is"
+)
+
+type address struct {
+	City string
+	Zip  string
+}
+
+type customer struct {
+	Name      string
+	Tier      int
+	Since     time.Time
+	Addresses []address
+}
+
+type order struct {
+	Total    float64          `indigo:"total"`
+	Quantity uint             `indigo:"quantity"`
+	Customer *customer        `indigo:"customer"`
+	Tags     []string         `indigo:"tags"`
+	Student  *school.Student  `indigo:"student"`
+	Placed   time.Time        `indigo:"placed"`
+	Window   time.Duration    `indigo:"window"`
+	Coupon   string           `indigo:"coupon,optional"`
+	Limits   map[string]int64 `indigo:"limits"`
+	Notes    string           `indigo:"-"`
+	internal string
+}
+
+func TestSchemaFromStruct(t *testing.T) {
+	is := is.New(t)
+
+	s, err := indigo.SchemaFromStruct(&order{})
+	is.NoErr(err)
+	is.Equal(s.ID, "order")
+
+	got := []string{}
+	for _, e := range s.Elements {
+		got = append(got, e.String())
+	}
+	is.Equal(got, []string{
+		"  total (float)",
+		"  quantity (int)",
+		"  customer (struct(indigo_test.customer), optional)",
+		"  tags ([]string)",
+		"  student (proto(testdata.school.Student), optional)",
+		"  placed (timestamp)",
+		"  window (duration)",
+		"  coupon (string, optional)",
+		"  limits (map[string]int)",
+	})
+
+	_, err = indigo.SchemaFromStruct(struct{ Counts []uint }{})
+	is.True(err != nil)
+
+	_, err = indigo.SchemaFromStruct(42)
+	is.True(err != nil)
+}
+
+func TestEvalStruct(t *testing.T) {
+	is := is.New(t)
+
+	s, err := indigo.SchemaFromStruct(order{})
+	is.NoErr(err)
+
+	r := &indigo.Rule{
+		ID:     "big_paris_order",
+		Schema: s,
+		Expr: `customer.Name == "Ada" && customer.Addresses[0].City == "Paris" && customer.Tier > 1 &&
+			quantity > 2 && total > 10.0 && student.gpa > 3.0 && "vip" in tags && limits.daily < 5 &&
+			placed - customer.Since > window`,
+	}
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(r))
+
+	o := order{
+		Total:    25.0,
+		Quantity: 3,
+		Customer: &customer{
+			Name:      "Ada",
+			Tier:      2,
+			Since:     time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Addresses: []address{{City: "Paris", Zip: "75001"}},
+		},
+		Tags:    []string{"vip"},
+		Student: &school.Student{Gpa: 3.5},
+		Placed:  time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		Window:  24 * time.Hour,
+		Limits:  map[string]int64{"daily": 1},
+	}
+
+	d, err := indigo.DataFromStruct(&o)
+	is.NoErr(err)
+	is.Equal(d["quantity"], int64(3))
+	_, ok := d["Notes"]
+	is.True(!ok)
+	is.Equal(len(s.Validate(d)), 0)
+
+	u, err := e.Eval(context.Background(), r, d)
+	is.NoErr(err)
+	is.True(u.Pass)
+
+	o.Customer.Addresses[0].City = "Lyon"
+	d, err = indigo.DataFromStruct(&o)
+	is.NoErr(err)
+	u, err = e.Eval(context.Background(), r, d)
+	is.NoErr(err)
+	is.True(!u.Pass)
+
+	// nil pointers are left out
+	o.Customer = nil
+	d, err = indigo.DataFromStruct(o)
+	is.NoErr(err)
+	_, ok = d["customer"]
+	is.True(!ok)
+	is.Equal(len(s.Validate(d)), 0)
+
+	// maps decoded from JSON are converted to the struct
+	d["customer"] = map[string]interface{}{"Name": "Ada", "Tier": 3}
+	c, err := s.Coerce(d)
+	is.NoErr(err)
+	is.Equal(c["customer"].(*customer).Tier, 3)
+}
@@ -0,0 +1,320 @@
+package indigo
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RuleTemplate is a rule expression with parameters, used to create many
+// rules that differ only in the values of the parameters. Parameters are
+// written in the expression as {{name}}:
+//
+//	order.total > {{limit}} && region == {{region}}
+//
+// A placeholder stands for a value of the parameter's type, not for text; it
+// may be written inside quotes ('{{region}}' or "{{region}}"), in which case
+// the quotes are part of the placeholder.
+//
+// Use Instantiate to create a rule from the template. The rule's expression
+// is the template's expression, with each placeholder replaced by the value of
+// the parameter written as a CEL literal, so the rule must be evaluated with
+// the CEL evaluator.
+//
+// Instantiated rules are compiled like any other rule. To avoid compiling
+// every rule, compile the template once with DefaultEngine.CompileTemplate
+// before instantiating it. The rules then share the template's compiled
+// program, in which the parameters are variables, and the engine provides the
+// rule's parameter values as data when the rule is evaluated.
+type RuleTemplate struct {
+	// A template identifier, used in error messages (required)
+	ID string `json:"id"`
+
+	// The expression, with placeholders for the parameters
+	Expr string `json:"expr"`
+
+	// The result type, schema and evaluation options of the rules
+	// created from the template
+	ResultType  Type        `json:"result_type,omitempty"`
+	Schema      Schema      `json:"schema,omitempty"`
+	EvalOptions EvalOptions `json:"eval_options"`
+
+	// The parameters used in the expression
+	Params []TemplateParam `json:"params,omitempty"`
+
+	// The expression compiled by CompileTemplate, with the parameters as variables
+	Program interface{} `json:"-"`
+}
+
+// TemplateParam defines a parameter of a RuleTemplate.
+type TemplateParam struct {
+	// The name of the parameter, used in the template expression as {{name}}.
+	// The name must be a valid identifier.
+	Name string `json:"name"`
+
+	// The type of the parameter. Supported types are Int, Float, String,
+	// Bool, Duration, Timestamp, and Lists of these.
+	Type Type `json:"type"`
+
+	// The value used if no value is given for the parameter. If the default
+	// is nil, a value is required.
+	Default interface{} `json:"default,omitempty"`
+
+	// Human-readable description of the parameter
+	Description string `json:"description,omitempty"`
+}
+
+// templateBinding holds the parameter values of a rule instantiated from a
+// compiled template.
+type templateBinding struct {
+	// the rule's expression at the time it was instantiated; the template's
+	// program is only used while the expression is unchanged
+	expr    string
+	program interface{}
+	params  map[string]interface{}
+}
+
+// paramPrefix is added to the names of the parameters of a compiled template
+// to obtain the names of the variables in the program.
+const paramPrefix = "param_"
+
+// placeholder matches a parameter placeholder, optionally in quotes.
+var placeholder = regexp.MustCompile(`'\{\{\s*(\w+)\s*\}\}'|"\{\{\s*(\w+)\s*\}\}"|\{\{\s*(\w+)\s*\}\}`)
+
+// identifier matches a valid parameter name.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Instantiate creates a rule with the ID from the template, using the
+// parameter values, which must be of the parameters' types. It returns an
+// error if a value is missing or of the wrong type, or if a value is given
+// for a parameter the template does not have.
+//
+// If the template has been compiled with CompileTemplate, the rule shares the
+// template's program, and does not need to be compiled.
+func (t *RuleTemplate) Instantiate(id string, values map[string]interface{}) (*Rule, error) {
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+
+	for k := range values {
+		if t.param(k) == nil {
+			return nil, fmt.Errorf("template %s: rule %s: unknown parameter %s", t.ID, id, k)
+		}
+	}
+
+	params := make(map[string]interface{}, len(t.Params))
+	literals := make(map[string]string, len(t.Params))
+	for _, p := range t.Params {
+		v, ok := values[p.Name]
+		if !ok || v == nil {
+			v = p.Default
+		}
+		if v == nil {
+			return nil, fmt.Errorf("template %s: rule %s: missing value for parameter %s", t.ID, id, p.Name)
+		}
+
+		pv, lit, err := paramValue(p.Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: rule %s: parameter %s: %w", t.ID, id, p.Name, err)
+		}
+		params[p.Name] = pv
+		literals[p.Name] = lit
+	}
+
+	r := &Rule{
+		ID:          id,
+		Expr:        t.replace(func(name string) string { return literals[name] }),
+		ResultType:  t.ResultType,
+		Schema:      t.Schema,
+		EvalOptions: t.EvalOptions,
+	}
+	r.Schema.Elements = append([]DataElement(nil), t.Schema.Elements...)
+
+	if t.Program != nil {
+		r.Program = t.Program
+		r.template = &templateBinding{
+			expr:    r.Expr,
+			program: t.Program,
+			params:  params,
+		}
+		r.hash = r.Hash()
+	}
+	return r, nil
+}
+
+// CompileTemplate compiles the template's expression once, with the
+// parameters as variables of their types, so that the rules created from the
+// template with Instantiate do not need to be compiled. Compiling a rule tree
+// that includes instantiated rules reuses the template's program for those
+// rules, unless their expression has been changed.
+//
+// In the compiled program, each parameter is a variable named after the
+// parameter with the prefix "param_", so that parameters may have the same
+// names as data elements.
+func (e *DefaultEngine) CompileTemplate(t *RuleTemplate, opts ...CompilationOption) error {
+	if e == nil || e.e == nil {
+		return fmt.Errorf("missing engine or evaluator")
+	}
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	o := compileOptions{}
+	applyCompilerOptions(&o, opts...)
+
+	schema := t.Schema
+	schema.Elements = append([]DataElement(nil), t.Schema.Elements...)
+	for _, p := range t.Params {
+		schema.Elements = append(schema.Elements, DataElement{Name: paramPrefix + p.Name, Type: p.Type, Description: p.Description})
+	}
+
+	resultType := t.ResultType
+	if resultType == nil {
+		resultType = Bool{}
+	}
+
+	expr := t.replace(func(name string) string { return paramPrefix + name })
+	prg, err := e.e.Compile(expr, schema, resultType, o.collectDiagnostics, o.dryRun)
+	if err != nil {
+		return fmt.Errorf("template %s: %w", t.ID, err)
+	}
+
+	if !o.dryRun {
+		t.Program = prg
+	}
+	return nil
+}
+
+// validate checks the template's parameters and placeholders.
+func (t *RuleTemplate) validate() error {
+	if t == nil {
+		return fmt.Errorf("template is nil")
+	}
+
+	elements := map[string]bool{}
+	for _, e := range t.Schema.Elements {
+		elements[e.Name] = true
+	}
+
+	seen := map[string]bool{}
+	for _, p := range t.Params {
+		switch {
+		case !identifier.MatchString(p.Name):
+			return fmt.Errorf("template %s: invalid parameter name %q", t.ID, p.Name)
+		case seen[p.Name]:
+			return fmt.Errorf("template %s: duplicate parameter %s", t.ID, p.Name)
+		case elements[paramPrefix+p.Name]:
+			return fmt.Errorf("template %s: parameter %s: the schema element name %s is reserved for the parameter", t.ID, p.Name, paramPrefix+p.Name)
+		case p.Type == nil:
+			return fmt.Errorf("template %s: parameter %s has no type", t.ID, p.Name)
+		}
+		seen[p.Name] = true
+
+		if p.Default != nil {
+			if _, _, err := paramValue(p.Type, p.Default); err != nil {
+				return fmt.Errorf("template %s: parameter %s: default: %w", t.ID, p.Name, err)
+			}
+		}
+	}
+
+	for _, m := range placeholder.FindAllStringSubmatch(t.Expr, -1) {
+		name := m[1] + m[2] + m[3]
+		if !seen[name] {
+			return fmt.Errorf("template %s: undeclared parameter %s", t.ID, name)
+		}
+	}
+	return nil
+}
+
+// param returns the parameter with the name, or nil.
+func (t *RuleTemplate) param(name string) *TemplateParam {
+	for i := range t.Params {
+		if t.Params[i].Name == name {
+			return &t.Params[i]
+		}
+	}
+	return nil
+}
+
+// replace returns the template's expression with each placeholder replaced
+// by the text returned by fn for the parameter name.
+func (t *RuleTemplate) replace(fn func(name string) string) string {
+	return placeholder.ReplaceAllStringFunc(t.Expr, func(s string) string {
+		m := placeholder.FindStringSubmatch(s)
+		return fn(m[1] + m[2] + m[3])
+	})
+}
+
+// bind returns a copy of the data with the rule's parameter values added.
+func (b *templateBinding) bind(d map[string]interface{}) map[string]interface{} {
+	data := make(map[string]interface{}, len(d)+len(b.params))
+	for k, v := range d {
+		data[k] = v
+	}
+	for k, v := range b.params {
+		data[paramPrefix+k] = v
+	}
+	return data
+}
+
+// paramValue checks that the value is of the type, returning the value as
+// it is provided to a compiled template's program, and written as a CEL
+// literal.
+func paramValue(typ Type, v interface{}) (interface{}, string, error) {
+	rv := reflect.ValueOf(v)
+
+	switch t := typ.(type) {
+	case Int:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i := rv.Int()
+			return i, strconv.FormatInt(i, 10), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if u := rv.Uint(); u <= 1<<63-1 {
+				return int64(u), strconv.FormatUint(u, 10), nil
+			}
+		}
+	case Float:
+		switch rv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			lit, err := parseLiteral(strconv.FormatFloat(rv.Float(), 'g', -1, 64), Float{})
+			return rv.Float(), lit.cel, err
+		}
+	case String:
+		if rv.Kind() == reflect.String {
+			return rv.String(), strconv.Quote(rv.String()), nil
+		}
+	case Bool:
+		if rv.Kind() == reflect.Bool {
+			return rv.Bool(), strconv.FormatBool(rv.Bool()), nil
+		}
+	case Duration:
+		if d, ok := v.(time.Duration); ok {
+			return d, fmt.Sprintf("duration(%q)", d.String()), nil
+		}
+	case Timestamp:
+		if ts, ok := v.(time.Time); ok {
+			return ts, fmt.Sprintf("timestamp(%q)", ts.UTC().Format(time.RFC3339Nano)), nil
+		}
+	case List:
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			break
+		}
+		l := make([]interface{}, rv.Len())
+		lits := make([]string, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			ev, lit, err := paramValue(t.ValueType, rv.Index(i).Interface())
+			if err != nil {
+				return nil, "", fmt.Errorf("element %d: %w", i, err)
+			}
+			l[i], lits[i] = ev, lit
+		}
+		return l, "[" + strings.Join(lits, ", ") + "]", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported parameter type %v", typ)
+	}
+	return nil, "", fmt.Errorf("value %v (%T) is not of type %v", v, v, typ)
+}
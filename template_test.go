@@ -0,0 +1,121 @@
+package indigo_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/matryer/is"
+)
+
+// compileCounter counts the number of expressions compiled.
+type compileCounter struct {
+	*cel.Evaluator
+	n int
+}
+
+func (c *compileCounter) Compile(expr string, s indigo.Schema, resultType indigo.Type, collectDiagnostics, dryRun bool) (interface{}, error) {
+	c.n++
+	return c.Evaluator.Compile(expr, s, resultType, collectDiagnostics, dryRun)
+}
+
+func makeLimitTemplate() *indigo.RuleTemplate {
+	return &indigo.RuleTemplate{
+		ID:   "limit",
+		Expr: `total > {{limit}} && region == '{{region}}' && age > {{grace}}`,
+		Schema: indigo.Schema{
+			ID: "order",
+			Elements: []indigo.DataElement{
+				{Name: "total", Type: indigo.Float{}},
+				{Name: "region", Type: indigo.String{}},
+				{Name: "age", Type: indigo.Duration{}},
+			},
+		},
+		Params: []indigo.TemplateParam{
+			{Name: "limit", Type: indigo.Float{}},
+			{Name: "region", Type: indigo.String{}},
+			{Name: "grace", Type: indigo.Duration{}, Default: 24 * time.Hour},
+		},
+	}
+}
+
+func TestTemplateInstantiate(t *testing.T) {
+	is := is.New(t)
+
+	tmpl := makeLimitTemplate()
+	r, err := tmpl.Instantiate("emea", map[string]interface{}{"limit": 100.0, "region": "EMEA"})
+	is.NoErr(err)
+	is.Equal(r.Expr, `total > 100.0 && region == "EMEA" && age > duration("24h0m0s")`)
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(r))
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{"total": 150.0, "region": "EMEA", "age": 48 * time.Hour})
+	is.NoErr(err)
+	is.True(u.Pass)
+
+	cases := map[string]map[string]interface{}{
+		"missing value for parameter region": {"limit": 100.0},
+		"unknown parameter color":            {"limit": 100.0, "region": "EMEA", "color": "red"},
+		"is not of type float":               {"limit": "100", "region": "EMEA"},
+	}
+	for want, values := range cases {
+		_, err := tmpl.Instantiate("x", values)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, wanted %q", err, want)
+		}
+	}
+
+	bad := makeLimitTemplate()
+	bad.Params = bad.Params[1:]
+	_, err = bad.Instantiate("x", map[string]interface{}{"region": "EMEA"})
+	is.True(err != nil && strings.Contains(err.Error(), "undeclared parameter limit"))
+
+	bad = makeLimitTemplate()
+	bad.Schema.Elements = append(bad.Schema.Elements, indigo.DataElement{Name: "param_limit", Type: indigo.Float{}})
+	_, err = bad.Instantiate("x", map[string]interface{}{"limit": 1.0, "region": "EMEA"})
+	is.True(err != nil && strings.Contains(err.Error(), "reserved"))
+}
+
+func TestCompiledTemplate(t *testing.T) {
+	is := is.New(t)
+
+	ev := &compileCounter{Evaluator: cel.NewEvaluator()}
+	e := indigo.NewEngine(ev)
+
+	tmpl := makeLimitTemplate()
+	is.NoErr(e.CompileTemplate(tmpl))
+	is.Equal(ev.n, 1)
+
+	root := &indigo.Rule{ID: "limits", EvalOptions: indigo.EvalOptions{TrueIfAny: true}}
+	regions := map[string]float64{"EMEA": 100, "APAC": 200, "AMER": 300}
+	for _, region := range []string{"EMEA", "APAC", "AMER"} {
+		r, err := tmpl.Instantiate(strings.ToLower(region), map[string]interface{}{"limit": regions[region], "region": region})
+		is.NoErr(err)
+		is.NoErr(root.AddChild(r))
+	}
+
+	// only the root rule's expression is compiled
+	is.NoErr(e.Compile(root))
+	is.Equal(ev.n, 2)
+
+	d := map[string]interface{}{"total": 250.0, "region": "APAC", "age": 48 * time.Hour}
+	u, err := e.Eval(context.Background(), root, d)
+	is.NoErr(err)
+	is.True(!u.Results["emea"].Pass)
+	is.True(u.Results["apac"].Pass)
+	is.True(!u.Results["amer"].Pass)
+	is.True(u.Results["apac"].RuleHash != "")
+
+	// a rule whose expression was changed is compiled on its own
+	root.Rules["amer"].Expr = `total > 1.0`
+	is.NoErr(e.Compile(root))
+	is.Equal(ev.n, 4)
+	d["region"] = "AMER"
+	u, err = e.Eval(context.Background(), root, d)
+	is.NoErr(err)
+	is.True(u.Results["amer"].Pass)
+	is.True(!u.Results["apac"].Pass)
+}
@@ -0,0 +1,221 @@
+package indigo
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Violation describes a value in the input data that does not match the
+// schema.
+type Violation struct {
+	// The name of the data element
+	Element string
+
+	// The position of the invalid value within the element's value, such as
+	// [2] for an element of a list or ["key"] for a value in a map. Blank if
+	// the element's value itself is invalid.
+	Path string
+
+	// The type the schema expects
+	Type Type
+
+	// A description of the problem
+	Message string
+}
+
+// String returns the violation as "element path: message".
+func (v Violation) String() string {
+	return fmt.Sprintf("%s%s: %s", v.Element, v.Path, v.Message)
+}
+
+// ValidationError is returned by Eval when the ValidateInput option is set
+// and the input data does not match the rules' schemas.
+type ValidationError struct {
+	Violations []Violation
+}
+
+// Error lists the violations.
+func (e *ValidationError) Error() string {
+	l := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		l = append(l, v.String())
+	}
+	return "invalid input data: " + strings.Join(l, "; ")
+}
+
+// Validate checks that the data has a value for each element in the schema
+// that is not optional, and that the values are of the elements' types. The
+// elements of lists and the keys and values of maps are checked against the
+// List and Map element types, proto messages must have the full name of the
+// Proto type, and Go structs (or pointers to them) must be of the type of the
+// Struct. Values in the data that are not in the schema are ignored.
+//
+// Values are compatible with a type if the CEL evaluator accepts them: Int
+// accepts signed integers, Float accepts float32 and float64 (not integers),
+// Duration accepts time.Duration and durationpb.Duration, Timestamp accepts
+// time.Time and timestamppb.Timestamp, and Any accepts any value.
+//
+// Validate returns the violations ordered by element name, or nil if the
+// data is valid.
+func (s *Schema) Validate(d map[string]interface{}) []Violation {
+	var l []Violation
+	for _, e := range s.Elements {
+		v, ok := d[e.Name]
+		if !ok {
+			if !e.Optional {
+				l = append(l, Violation{Element: e.Name, Type: e.Type, Message: "missing value"})
+			}
+			continue
+		}
+
+		// Values resolved by a DataProvider are not known yet
+		if _, ok := v.(*LazyValue); ok {
+			continue
+		}
+
+		l = append(l, validateValue(e.Name, "", e.Type, v)...)
+	}
+
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].Element < l[j].Element
+	})
+	return l
+}
+
+// validateValue checks that the value at the path of the element is of the type.
+func validateValue(element, path string, typ Type, v interface{}) []Violation {
+	invalid := func(format string, args ...interface{}) []Violation {
+		return []Violation{{Element: element, Path: path, Type: typ, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	if _, ok := typ.(Any); ok {
+		return nil
+	}
+	if v == nil {
+		return invalid("value is nil, expected %v", typ)
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch t := typ.(type) {
+	case String:
+		if rv.Kind() == reflect.String {
+			return nil
+		}
+	case Bool:
+		if rv.Kind() == reflect.Bool {
+			return nil
+		}
+	case Int:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return nil
+		}
+	case Float:
+		switch rv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return nil
+		}
+	case Duration:
+		switch v.(type) {
+		case time.Duration, *durationpb.Duration:
+			return nil
+		}
+	case Timestamp:
+		switch v.(type) {
+		case time.Time, *timestamppb.Timestamp:
+			return nil
+		}
+	case Proto:
+		want, err := t.ProtoFullName()
+		if err != nil {
+			return invalid("%v", err)
+		}
+		m, ok := v.(proto.Message)
+		if !ok {
+			break
+		}
+		if got := string(m.ProtoReflect().Descriptor().FullName()); got != want {
+			return invalid("proto message %s is not of type %v", got, typ)
+		}
+		return nil
+	case Struct:
+		want, err := t.StructType()
+		if err != nil {
+			return invalid("%v", err)
+		}
+		if rv.Type() == want || (rv.Kind() == reflect.Pointer && rv.Type().Elem() == want) {
+			return nil
+		}
+	case List:
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			break
+		}
+		var l []Violation
+		for i := 0; i < rv.Len(); i++ {
+			l = append(l, validateValue(element, fmt.Sprintf("%s[%d]", path, i), t.ValueType, rv.Index(i).Interface())...)
+		}
+		return l
+	case Map:
+		if rv.Kind() != reflect.Map {
+			break
+		}
+
+		// sort the keys so that the violations are in a stable order
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+
+		var l []Violation
+		for _, k := range keys {
+			kp := keyPath(path, k.Interface())
+			l = append(l, validateValue(element, kp+" (key)", t.KeyType, k.Interface())...)
+			l = append(l, validateValue(element, kp, t.ValueType, rv.MapIndex(k).Interface())...)
+		}
+		return l
+	default:
+		return invalid("unsupported type %v", typ)
+	}
+	return invalid("value %v (%T) is not of type %v", v, v, typ)
+}
+
+// validateInput checks the data against the schemas of the rule and its
+// descendants, returning a ValidationError if it does not match. The self
+// element is not checked, since rules provide it.
+func validateInput(r *Rule, d map[string]interface{}) error {
+	seen := map[string]bool{}
+	var l []Violation
+	_ = ApplyToRule(r, func(r *Rule) error {
+		s := r.EffectiveSchema()
+		for _, v := range s.Validate(d) {
+			if v.Element == selfKey || seen[v.String()] {
+				continue
+			}
+			seen[v.String()] = true
+			l = append(l, v)
+		}
+		return nil
+	})
+
+	if len(l) > 0 {
+		return &ValidationError{Violations: l}
+	}
+	return nil
+}
+
+// keyPath returns the path of the value with the map key k within the value
+// at path.
+func keyPath(path string, k interface{}) string {
+	if s, ok := k.(string); ok {
+		return fmt.Sprintf("%s[%q]", path, s)
+	}
+	return fmt.Sprintf("%s[%v]", path, k)
+}
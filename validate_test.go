@@ -0,0 +1,113 @@
+package indigo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/ezachrisen/indigo/cel"
+	"github.com/ezachrisen/indigo/testdata/school"
+	"github.com/matryer/is"
+)
+
+func makeValidationSchema() indigo.Schema {
+	return indigo.Schema{
+		ID: "validation",
+		Elements: []indigo.DataElement{
+			{Name: "student", Type: indigo.Proto{Message: &school.Student{}}},
+			{Name: "gpa", Type: indigo.Float{}},
+			{Name: "age", Type: indigo.Int{}},
+			{Name: "tags", Type: indigo.List{ValueType: indigo.String{}}},
+			{Name: "scores", Type: indigo.Map{KeyType: indigo.String{}, ValueType: indigo.Float{}}},
+			{Name: "enrolled", Type: indigo.Timestamp{}},
+			{Name: "nickname", Type: indigo.String{}, Optional: true},
+			{Name: "extra", Type: indigo.Any{}},
+		},
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	is := is.New(t)
+
+	s := makeValidationSchema()
+
+	valid := map[string]interface{}{
+		"student":  &school.Student{},
+		"gpa":      3.5,
+		"age":      int64(17),
+		"tags":     []string{"a", "b"},
+		"scores":   map[string]float64{"math": 4.0},
+		"enrolled": time.Now(),
+		"extra":    nil,
+		"unknown":  "ignored",
+	}
+	is.Equal(len(s.Validate(valid)), 0)
+
+	invalid := map[string]interface{}{
+		"student":  &school.HonorsConfiguration{},
+		"gpa":      int64(3),
+		"tags":     []interface{}{"a", 2},
+		"scores":   map[string]interface{}{"math": 4.0, "art": "A"},
+		"enrolled": "2022-01-01",
+		"extra":    1,
+	}
+
+	l := s.Validate(invalid)
+	got := []string{}
+	for _, v := range l {
+		got = append(got, v.String())
+	}
+	is.Equal(got, []string{
+		"age: missing value",
+		"enrolled: value 2022-01-01 (string) is not of type timestamp",
+		"gpa: value 3 (int64) is not of type float",
+		`scores["art"]: value A (string) is not of type float`,
+		"student: proto message testdata.school.HonorsConfiguration is not of type proto(testdata.school.Student)",
+		"tags[1]: value 2 (int) is not of type string",
+	})
+	is.Equal(l[0].Type, indigo.Int{})
+	is.Equal(l[3].Element, "scores")
+	is.Equal(l[3].Path, `["art"]`)
+}
+
+func TestValidateInput(t *testing.T) {
+	is := is.New(t)
+
+	r := &indigo.Rule{
+		ID:     "root",
+		Schema: makeValidationSchema(),
+		Rules: map[string]*indigo.Rule{
+			"honors": {
+				ID:   "honors",
+				Expr: "gpa > 3.5",
+			},
+		},
+	}
+
+	e := indigo.NewEngine(cel.NewEvaluator())
+	is.NoErr(e.Compile(r))
+
+	d := map[string]interface{}{
+		"student":  &school.Student{},
+		"gpa":      4,
+		"age":      17,
+		"tags":     []string{},
+		"scores":   map[string]float64{},
+		"enrolled": time.Now(),
+		"extra":    true,
+	}
+
+	_, err := e.Eval(context.Background(), r, d, indigo.ValidateInput(true))
+	var ve *indigo.ValidationError
+	is.True(errors.As(err, &ve))
+	is.Equal(len(ve.Violations), 1)
+	is.Equal(ve.Violations[0].Element, "gpa")
+	is.Equal(err.Error(), "invalid input data: gpa: value 4 (int) is not of type float")
+
+	d["gpa"] = 4.0
+	u, err := e.Eval(context.Background(), r, d, indigo.ValidateInput(true))
+	is.NoErr(err)
+	is.True(u.Pass)
+}
@@ -0,0 +1,265 @@
+package indigo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Hash returns a content hash of the rule and its children.
+// The hash covers the parts of the rule that determine the outcome of an
+// evaluation: the ID, expression, output, priority, weight, dependencies,
+// actions, whether it is disabled, effective period, result type, schema,
+// extra data elements and evaluation options of the rule and all of its
+// children, and the order of the children. The Version, Self, Meta and
+// Program fields, as well as the SortFunc evaluation option, are not
+// included.
+//
+// Two rule trees with the same hash will produce the same results when
+// evaluated with the same data.
+func (r *Rule) Hash() string {
+	return r.contentHash(func(c *Rule) string { return c.Hash() })
+}
+
+// ruleContent is the canonical representation of a rule used to calculate
+// the content hash.
+type ruleContent struct {
+	ID          string      `json:"id"`
+	Expr        string      `json:"expr"`
+	Priority    int         `json:"priority,omitempty"`
+	Weight      float64     `json:"weight,omitempty"`
+	DependsOn   []string    `json:"depends_on,omitempty"`
+	OnPass      []string    `json:"on_pass,omitempty"`
+	OnFail      []string    `json:"on_fail,omitempty"`
+	Disabled    bool        `json:"disabled,omitempty"`
+	From        string      `json:"effective_from,omitempty"`
+	Until       string      `json:"effective_until,omitempty"`
+	Output      string      `json:"output,omitempty"`
+	ResultType  string      `json:"result_type"`
+	SchemaID    string      `json:"schema_id"`
+	Elements    []string    `json:"elements"`
+	Extra       []string    `json:"extra_elements,omitempty"`
+	EvalOptions EvalOptions `json:"eval_options"`
+	Rules       []string    `json:"rules"`
+}
+
+// contentHash calculates the hash of the rule, using the function childHash
+// to obtain the hash of each child rule.
+func (r *Rule) contentHash(childHash func(c *Rule) string) string {
+	c := ruleContent{
+		ID:          r.ID,
+		Expr:        r.Expr,
+		Priority:    r.Priority,
+		Weight:      r.Weight,
+		DependsOn:   r.DependsOn,
+		OnPass:      r.OnPass,
+		OnFail:      r.OnFail,
+		Disabled:    r.Disabled,
+		From:        timeString(r.EffectiveFrom),
+		Until:       timeString(r.EffectiveUntil),
+		SchemaID:    r.Schema.ID,
+		EvalOptions: r.EvalOptions,
+	}
+
+	if r.ResultType != nil {
+		c.ResultType = r.ResultType.String()
+	}
+
+	if r.Output != nil {
+		out, err := encodeValue(r.Output)
+		if err != nil {
+			out = []byte(fmt.Sprintf("%#v", r.Output))
+		}
+		c.Output = string(out)
+	}
+
+	for _, e := range r.Schema.Elements {
+		c.Elements = append(c.Elements, e.String())
+	}
+
+	for _, e := range r.ExtraElements {
+		c.Extra = append(c.Extra, e.String())
+	}
+
+	for _, k := range r.childOrder() {
+		c.Rules = append(c.Rules, k+"="+childHash(r.Rules[k]))
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		// ruleContent only holds strings and the JSON-serializable fields of
+		// EvalOptions, so this should never happen.
+		panic(fmt.Sprintf("indigo: calculating hash of rule %s: %v", r.ID, err))
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// timeString formats the time for hashing and comparison, blank if the
+// time is zero.
+func timeString(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// Clone returns a copy of the rule and its children.
+// The rule hierarchy, schemas and evaluation options are copied, while the
+// Self, Meta and Program references are shared with the original rule.
+// A copy of a rule tree with dependencies between rules (see DependsOn) must
+// be compiled before it is evaluated.
+func (r *Rule) Clone() *Rule {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.Schema.Elements = append([]DataElement(nil), r.Schema.Elements...)
+	c.sortedRules = nil
+	c.deps = nil
+	c.referenced = false
+	c.DependsOn = append([]string(nil), r.DependsOn...)
+	c.OnPass = append([]string(nil), r.OnPass...)
+	c.OnFail = append([]string(nil), r.OnFail...)
+	c.ExtraElements = append([]DataElement(nil), r.ExtraElements...)
+	c.order = append([]string(nil), r.order...)
+	if r.Rules != nil {
+		c.Rules = make(map[string]*Rule, len(r.Rules))
+		for k, cr := range r.Rules {
+			c.Rules[k] = cr.Clone()
+		}
+	}
+	return &c
+}
+
+// VersionInfo describes a version of a rule tree kept in a RuleStore.
+type VersionInfo struct {
+	// The version of the root rule (see Rule.Version)
+	Version string
+
+	// The content hash of the rule tree (see Rule.Hash)
+	Hash string
+
+	// When this version was added to the store
+	Stored time.Time
+}
+
+// RuleStore is the interface for keeping the history of rule trees.
+// Rule trees are identified by the ID and Version of the root rule.
+type RuleStore interface {
+	// Put adds a version of a rule tree to the store. The rule's Version must be set.
+	Put(r *Rule) error
+
+	// Get retrieves a version of a rule tree from the store.
+	Get(id, version string) (*Rule, error)
+
+	// Versions lists the versions of a rule tree in the order they were stored.
+	Versions(id string) ([]VersionInfo, error)
+}
+
+// MemoryStore is an in-memory implementation of RuleStore.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	trees map[string][]storedRule
+}
+
+type storedRule struct {
+	info VersionInfo
+	rule *Rule
+}
+
+// NewMemoryStore initializes and returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		trees: map[string][]storedRule{},
+	}
+}
+
+// Put adds a copy of the rule tree to the store.
+// Storing a version that already exists is allowed if the content of the
+// rule tree is unchanged; if the content is different, Put returns an error.
+func (s *MemoryStore) Put(r *Rule) error {
+	switch {
+	case r == nil:
+		return fmt.Errorf("rule is nil")
+	case r.ID == "":
+		return fmt.Errorf("rule ID is required")
+	case r.Version == "":
+		return fmt.Errorf("rule %s: version is required", r.ID)
+	}
+
+	h := r.Hash()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, v := range s.trees[r.ID] {
+		if v.info.Version == r.Version {
+			if v.info.Hash != h {
+				return fmt.Errorf("rule %s: version %s already stored with different content", r.ID, r.Version)
+			}
+			return nil
+		}
+	}
+
+	s.trees[r.ID] = append(s.trees[r.ID], storedRule{
+		info: VersionInfo{
+			Version: r.Version,
+			Hash:    h,
+			Stored:  time.Now(),
+		},
+		rule: r.Clone(),
+	})
+	return nil
+}
+
+// Get returns a copy of the stored version of the rule tree.
+// The rule must be compiled before it is evaluated.
+func (s *MemoryStore) Get(id, version string) (*Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, v := range s.trees[id] {
+		if v.info.Version == version {
+			return v.rule.Clone(), nil
+		}
+	}
+	return nil, fmt.Errorf("rule %s: version %s not found", id, version)
+}
+
+// Versions lists the versions of the rule tree in the order they were stored.
+func (s *MemoryStore) Versions(id string) ([]VersionInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.trees[id]
+	if !ok {
+		return nil, fmt.Errorf("rule %s not found", id)
+	}
+
+	l := make([]VersionInfo, len(stored))
+	for i := range stored {
+		l[i] = stored[i].info
+	}
+	return l, nil
+}
+
+// DiffVersions retrieves two versions of a rule tree from the store and
+// returns the changes between them.
+func DiffVersions(s RuleStore, id, from, to string) (Changes, error) {
+	a, err := s.Get(id, from)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := s.Get(id, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return Diff(a, b), nil
+}
@@ -0,0 +1,100 @@
+package indigo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ezachrisen/indigo"
+	"github.com/matryer/is"
+)
+
+func TestHash(t *testing.T) {
+	is := is.New(t)
+
+	a := makeRule()
+	b := makeRule()
+	is.Equal(a.Hash(), b.Hash())
+
+	// The version is not part of the content
+	b.Version = "2"
+	is.Equal(a.Hash(), b.Hash())
+
+	b.Rules["B"].Rules["b4"].Rules["b4-1"].Expr = `false`
+	is.True(a.Hash() != b.Hash())
+
+	c := makeRule()
+	c.Rules["D"].EvalOptions.StopFirstPositiveChild = true
+	is.True(a.Hash() != c.Hash())
+}
+
+func TestResultVersion(t *testing.T) {
+	is := is.New(t)
+
+	e := indigo.NewEngine(newMockEvaluator())
+	r := makeRule()
+	r.Version = "7"
+	r.Rules["D"].Version = "3"
+
+	err := e.Compile(r)
+	is.NoErr(err)
+
+	u, err := e.Eval(context.Background(), r, map[string]interface{}{})
+	is.NoErr(err)
+	is.Equal(u.RuleVersion, "7")
+	is.Equal(u.RuleHash, r.Hash())
+	is.Equal(u.Results["D"].RuleVersion, "3")
+	is.Equal(u.Results["D"].RuleHash, r.Rules["D"].Hash())
+	is.Equal(u.Results["B"].RuleVersion, "")
+}
+
+func TestMemoryStore(t *testing.T) {
+	is := is.New(t)
+
+	s := indigo.NewMemoryStore()
+
+	v1 := makeRule()
+	is.True(s.Put(v1) != nil) // version is required
+
+	v1.Version = "1"
+	is.NoErr(s.Put(v1))
+	is.NoErr(s.Put(v1)) // unchanged content is ok
+
+	v2 := makeRule()
+	v2.Version = "2"
+	v2.Rules["D"].Expr = `false`
+	delete(v2.Rules, "E")
+	v2.Rules["F"] = &indigo.Rule{ID: "F", Expr: `true`}
+	v2.EvalOptions.TrueIfAny = true
+	is.NoErr(s.Put(v2))
+
+	v2.Rules["D"].Expr = `true`
+	is.True(s.Put(v2) != nil) // same version, different content
+
+	// Changes to the original rule do not affect the stored version
+	v1.Expr = `false`
+	got, err := s.Get("rule1", "1")
+	is.NoErr(err)
+	is.Equal(got.Expr, `true`)
+	is.Equal(len(got.Rules), 3)
+
+	_, err = s.Get("rule1", "3")
+	is.True(err != nil)
+
+	versions, err := s.Versions("rule1")
+	is.NoErr(err)
+	is.Equal(len(versions), 2)
+	is.Equal(versions[0].Version, "1")
+	is.Equal(versions[1].Version, "2")
+	is.True(versions[0].Hash != versions[1].Hash)
+
+	changes, err := indigo.DiffVersions(s, "rule1", "1", "2")
+	is.NoErr(err)
+
+	want := indigo.Changes{
+		{Kind: indigo.EvalOptionsChanged, RuleID: "rule1", Path: "rule1", Field: "true_if_any", Old: "false", New: "true"},
+		{Kind: indigo.ExprChanged, RuleID: "D", Path: "rule1/D", Old: "true", New: "false"},
+		{Kind: indigo.RuleRemoved, RuleID: "E", Path: "rule1/E", Old: "false"},
+		{Kind: indigo.RuleAdded, RuleID: "F", Path: "rule1/F", New: "true"},
+	}
+	is.Equal(changes, want)
+}